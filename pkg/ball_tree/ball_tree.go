@@ -1,8 +1,6 @@
 package balltree
 
 import (
-	"fmt"
-	"log"
 	"math"
 	"math/rand"
 
@@ -14,44 +12,92 @@ type BallTree struct {
 	Left      *BallTree     `json:"left"`
 	Right     *BallTree     `json:"right"`
 	Dimension int           `json:"dimension"`
+	// Cached at every node when set
+	aggregate *common.Aggregate
+	// The IdentifiedPoints of the tree by ID, kept at the top of the tree only
+	ids common.IDIndex
 }
 
 var _tree common.SpacePartitioningTree = &BallTree{}
+var _subtree common.Subtree = &BallTree{}
 
-func (tree *BallTree) Construct(points []common.Point, dimension int) error {
-	points = common.Filter(points, func(p common.Point) bool {
-		return p.Dimension() == dimension
-	})
+func (tree *BallTree) Construct(points []common.Point, dimension int, options ...common.ConstructOption) error {
+	settings := common.NewConstructOptions(options...)
+	points, err := settings.Accept(points, dimension)
+	if err != nil {
+		return err
+	}
+	ids, err := common.NewIDIndex(points)
+	if err != nil {
+		return err
+	}
+	if len(points) > 0 {
+		if err := common.CheckPositiveDimension("tree", dimension); err != nil {
+			return err
+		}
+	}
+	tree.Root, tree.Left, tree.Right = nil, nil, nil
 	tree.Dimension = dimension
-	err := tree.recursivelyConstruct(points)
+	tree.aggregate = settings.Aggregate
+	tree.ids = ids
+	err = tree.recursivelyConstruct(points, settings.Random)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (tree *BallTree) recursivelyConstruct(points []common.Point) error {
+func (tree *BallTree) recursivelyConstruct(points []common.Point, random *rand.Rand) error {
 	if len(points) == 0 {
 		return nil
 	}
-	midPoint, orderingAxis := tree.bouncingBallAxis(points)
+	midPoint, orderingAxis, err := tree.bouncingBallAxis(points, random)
+	if err != nil {
+		return err
+	}
 	radius := findRadiusOfBall(points, midPoint)
-	pivot, smaller, larger, err := common.FindMedianByOrdering(orderingAxis, points)
+	pivot, smaller, larger, err := common.FindMedianByOrdering(orderingAxis, points, random)
 	if err != nil {
 		return err
 	}
 	tree.Root = &BallTreeNode{Centroid: midPoint, Data: pivot, Radius: radius}
 	if len(smaller) > 0 {
-		tree.Left = &BallTree{Dimension: tree.Dimension}
-		tree.Left.recursivelyConstruct(smaller)
+		tree.Left = &BallTree{Dimension: tree.Dimension, aggregate: tree.aggregate}
+		if err := tree.Left.recursivelyConstruct(smaller, random); err != nil {
+			return err
+		}
 	}
 	if len(larger) > 0 {
-		tree.Right = &BallTree{Dimension: tree.Dimension}
-		tree.Right.recursivelyConstruct(larger)
+		tree.Right = &BallTree{Dimension: tree.Dimension, aggregate: tree.aggregate}
+		if err := tree.Right.recursivelyConstruct(larger, random); err != nil {
+			return err
+		}
 	}
+	tree.refresh()
 	return nil
 }
 
+// Recomputes the values cached at the root from its own point and its children
+func (tree *BallTree) refresh() {
+	tree.Root.SubtreeSize = 1
+	tree.Root.SubtreeWeight = common.Weight(tree.Root.Data)
+	for _, child := range []*BallTree{tree.Left, tree.Right} {
+		if child != nil {
+			tree.Root.SubtreeSize += child.Size()
+			tree.Root.SubtreeWeight += child.weight()
+		}
+	}
+	if tree.aggregate != nil {
+		tree.Root.Aggregate = tree.aggregate.Lift(tree.Root.Data)
+		if tree.Left != nil {
+			tree.Root.Aggregate = tree.aggregate.Combine(tree.Left.Root.Aggregate, tree.Root.Aggregate)
+		}
+		if tree.Right != nil {
+			tree.Root.Aggregate = tree.aggregate.Combine(tree.Root.Aggregate, tree.Right.Root.Aggregate)
+		}
+	}
+}
+
 func findRadiusOfBall(points []common.Point, midPoint common.PointVector) float64 {
 	return common.Reduce[common.Point, float64](points, math.Inf(-1), func(r float64, p common.Point) float64 {
 		d, _ := common.Distance(p.Vector(), midPoint)
@@ -59,18 +105,30 @@ func findRadiusOfBall(points []common.Point, midPoint common.PointVector) float6
 	})
 }
 
-// Approximate axis of maximal variation
-func (tree *BallTree) bouncingBallAxis(points []common.Point) (common.PointVector, []float64) {
+// Approximate axis of maximal variation, bouncing from a random start point drawn from random,
+// or from the global source if it is nil
+func (tree *BallTree) bouncingBallAxis(points []common.Point, random *rand.Rand) (common.PointVector, []float64, error) {
 	if len(points) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 	vectors := make([]common.PointVector, len(points))
 	for i, p := range points {
 		vectors[i] = p.Vector()
 	}
-	start := vectors[rand.Intn(len(vectors))]
-	axisStart := furthestPoint(start, vectors)
-	axisEnd := furthestPoint(axisStart, vectors)
+	var start common.PointVector
+	if random != nil {
+		start = vectors[random.Intn(len(vectors))]
+	} else {
+		start = vectors[rand.Intn(len(vectors))]
+	}
+	axisStart, err := furthestPoint(start, vectors)
+	if err != nil {
+		return nil, nil, err
+	}
+	axisEnd, err := furthestPoint(axisStart, vectors)
+	if err != nil {
+		return nil, nil, err
+	}
 	axis, _ := common.Difference(axisStart, axisEnd)
 
 	midPoint := make(common.PointVector, len(axisStart))
@@ -82,31 +140,50 @@ func (tree *BallTree) bouncingBallAxis(points []common.Point) (common.PointVecto
 		dotProduct, _ := common.DotProduct(v, axis)
 		return dotProduct
 	})
-	return midPoint, dotProduct
+	return midPoint, dotProduct, nil
 }
 
-func furthestPoint(startVec common.PointVector, vecs []common.PointVector) common.PointVector {
+func furthestPoint(startVec common.PointVector, vecs []common.PointVector) (common.PointVector, error) {
 	d := 0.
 	result := startVec
 	for _, v := range vecs {
 		new_d, err := common.Distance(v, startVec)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 		if new_d > d {
 			result = v
 			d = new_d
 		}
 	}
-	return result
+	return result, nil
 }
 
 func (tree BallTree) Search(point common.Point, distance float64) ([]common.Point, error) {
-	if point.Dimension() != tree.Dimension {
-		return nil, fmt.Errorf("The query point has dimension %d, but the nodes of the tree are of dimension %d", point.Dimension(), tree.Dimension)
+	result := []common.Point{}
+	err := tree.SearchFunc(point, distance, func(p common.Point) bool {
+		result = append(result, p)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Calls fn on every point within distance of the query point, stopping as soon as fn returns false.
+// Unlike Search, no result slice is built.
+func (tree BallTree) SearchFunc(point common.Point, distance float64, fn func(common.Point) bool) error {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return err
+	}
+	if err := common.CheckRadius(distance); err != nil {
+		return err
+	}
+	if tree.Root == nil {
+		return nil
 	}
 	queryStack := []*BallTree{}
-	result := []common.Point{}
 	pointVector := point.Vector()
 	currentNode := &tree
 	for currentNode != nil || len(queryStack) > 0 {
@@ -122,10 +199,10 @@ func (tree BallTree) Search(point common.Point, distance float64) ([]common.Poin
 			// At this point you must use the vector associated with the data, not with the centroid of the ball
 			d, err := common.Distance(pointVector, currentNode.Root.Data.Vector())
 			if err != nil {
-				return nil, err
+				return err
 			}
-			if d < distance {
-				result = append(result, currentNode.Root.Data)
+			if d < distance && !fn(currentNode.Root.Data) {
+				return nil
 			}
 			if currentNode.Right != nil && currentNode.Right.Root.SearchChildren(pointVector, distance) {
 				currentNode = currentNode.Right
@@ -134,62 +211,30 @@ func (tree BallTree) Search(point common.Point, distance float64) ([]common.Poin
 			}
 		}
 	}
-	return result, nil
+	return nil
 }
 
+// Returns the k points of the tree nearest to the query point, nearest first, or every point
+// if the tree holds fewer than k
 func (tree BallTree) KNearestNeighbors(point common.Point, k int) ([]common.Point, error) {
-
-	if point.Dimension() != tree.Dimension {
-		return nil, fmt.Errorf("The query point has dimension %d, but the nodes of the tree are of dimension %d", point.Dimension(), tree.Dimension)
-	}
-	pointVector := point.Vector()
-	var candidateNeighbours []common.Point
-	var newNode *BallTree
-	currentNode := &tree
-	for currentNode != nil {
-		leftDistance := math.Inf(1)
-		rightDistance := math.Inf(1)
-		if currentNode.Left != nil {
-			leftDistance, _ = common.Distance(currentNode.Left.Root.Centroid, pointVector)
-		}
-		if currentNode.Right != nil {
-			rightDistance, _ = common.Distance(currentNode.Right.Root.Centroid, pointVector)
-		}
-		if leftDistance < rightDistance {
-			newNode = currentNode.Left
-		} else {
-			newNode = currentNode.Right
-		}
-		if newNode.Size() < k {
-			candidateNeighbours = currentNode.Points()
-			break
-		} else {
-			currentNode = newNode
-		}
+	if tree.Root == nil {
+		return nil, common.ErrEmptyTree
 	}
-	distances := common.Map(candidateNeighbours, func(candidate common.Point) float64 {
-		d, _ := common.Distance(candidate.Vector(), pointVector)
-		return d
-	})
-	candidateDistance := common.Reduce(distances, 0., math.Max)
-
-	candidateNeighbours, err := tree.Search(point, candidateDistance)
+	it, err := tree.NearestNeighborIterator(point)
 	if err != nil {
 		return nil, err
 	}
-	var candidatesWithDistances common.PointWithDistanceHeap
-	candidatesWithDistances = common.Map(candidateNeighbours, func(candidate common.Point) common.PointWithDistance {
-		d, _ := common.Distance(candidate.Vector(), pointVector)
-		return common.PointWithDistance{Point: candidate, Distance: d}
-	})
-
-	for len(candidatesWithDistances) > k {
-		candidatesWithDistances.Pop()
+	if err := common.CheckK(k); err != nil {
+		return nil, err
+	}
+	result := []common.Point{}
+	for len(result) < k {
+		p, _, ok := it.Next()
+		if !ok {
+			break
+		}
+		result = append(result, p)
 	}
-
-	result := common.Map(candidatesWithDistances, func(c common.PointWithDistance) common.Point {
-		return c.Point
-	})
 	return result, nil
 }
 
@@ -197,9 +242,37 @@ func (tree BallTree) NodeDimension() int {
 	return tree.Dimension
 }
 
+func (tree BallTree) Pivot() common.Point {
+	if tree.Root == nil {
+		return nil
+	}
+	return tree.Root.Data
+}
+
+func (tree BallTree) Bounds() common.Bounds {
+	if tree.Root == nil {
+		return common.Bounds{}
+	}
+	return common.Bounds{Centre: tree.Root.Centroid, Radius: tree.Root.Radius}
+}
+
+func (tree BallTree) Children() (common.Subtree, common.Subtree) {
+	var left, right common.Subtree
+	if tree.Left != nil {
+		left = tree.Left
+	}
+	if tree.Right != nil {
+		right = tree.Right
+	}
+	return left, right
+}
+
+// Returns the number of points in the tree, from the size cached at the root when it is known
 func (tree BallTree) Size() int {
 	if tree.Root == nil {
 		return 0
+	} else if tree.Root.SubtreeSize > 0 {
+		return tree.Root.SubtreeSize
 	} else if tree.Left == nil && tree.Right == nil {
 		return 1
 	} else if tree.Left == nil {
@@ -210,6 +283,23 @@ func (tree BallTree) Size() int {
 	return 1 + tree.Left.Size() + tree.Right.Size()
 }
 
+// Returns the total weight of the points in the tree, from the weight cached at the root when
+// the size is known
+func (tree BallTree) weight() float64 {
+	if tree.Root == nil {
+		return 0
+	} else if tree.Root.SubtreeSize > 0 {
+		return tree.Root.SubtreeWeight
+	}
+	result := common.Weight(tree.Root.Data)
+	for _, child := range []*BallTree{tree.Left, tree.Right} {
+		if child != nil {
+			result += child.weight()
+		}
+	}
+	return result
+}
+
 func (tree BallTree) Depth() int {
 	if tree.Root == nil {
 		return 0
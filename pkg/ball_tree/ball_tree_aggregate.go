@@ -0,0 +1,41 @@
+package balltree
+
+import "github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+
+// Returns the aggregate the tree was constructed with over the points inside the region.
+// When the region is a ContainingRegion, subtrees whose ball lies wholly inside it contribute
+// their cached value without being visited.
+func (tree BallTree) AggregateRegion(region common.Region) (any, error) {
+	if tree.aggregate == nil {
+		return nil, common.ErrNoAggregate
+	}
+	if err := common.CheckRegion(region, tree.Dimension); err != nil {
+		return nil, err
+	}
+	if tree.Root == nil {
+		return tree.aggregate.Identity, nil
+	}
+	containing, _ := region.(common.ContainingRegion)
+	return tree.aggregateRegion(region, containing), nil
+}
+
+// As countRegion, combining the left subtree, the root and the right subtree in that order
+func (tree *BallTree) aggregateRegion(region common.Region, containing common.ContainingRegion) any {
+	if !region.IntersectsBall(tree.Root.Centroid, tree.Root.Radius) {
+		return tree.aggregate.Identity
+	}
+	if containing != nil && containing.ContainsBall(tree.Root.Centroid, tree.Root.Radius) {
+		return tree.Root.Aggregate
+	}
+	result := tree.aggregate.Identity
+	if tree.Left != nil {
+		result = tree.Left.aggregateRegion(region, containing)
+	}
+	if region.Contains(tree.Root.Data.Vector()) {
+		result = tree.aggregate.Combine(result, tree.aggregate.Lift(tree.Root.Data))
+	}
+	if tree.Right != nil {
+		result = tree.aggregate.Combine(result, tree.Right.aggregateRegion(region, containing))
+	}
+	return result
+}
@@ -0,0 +1,106 @@
+package balltree
+
+import "github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+
+// Returns the number of points strictly within distance of the query point, without building
+// a result slice as Search does
+func (tree BallTree) Count(point common.Point, distance float64) (int, error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return 0, err
+	}
+	if err := common.CheckRadius(distance); err != nil {
+		return 0, err
+	}
+	return tree.CountRegion(common.Sphere{Centre: point.Vector(), Radius: distance})
+}
+
+// Returns the total weight of the points strictly within distance of the query point
+func (tree BallTree) WeightedCount(point common.Point, distance float64) (float64, error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return 0, err
+	}
+	if err := common.CheckRadius(distance); err != nil {
+		return 0, err
+	}
+	return tree.WeightedCountRegion(common.Sphere{Centre: point.Vector(), Radius: distance})
+}
+
+// Returns the number of points in the closed box [min, max]
+func (tree BallTree) CountBox(min, max common.PointVector) (int, error) {
+	if err := checkBox(min, max, tree.Dimension); err != nil {
+		return 0, err
+	}
+	return tree.CountRegion(common.Box{Min: min, Max: max})
+}
+
+// Returns the total weight of the points in the closed box [min, max]
+func (tree BallTree) WeightedCountBox(min, max common.PointVector) (float64, error) {
+	if err := checkBox(min, max, tree.Dimension); err != nil {
+		return 0, err
+	}
+	return tree.WeightedCountRegion(common.Box{Min: min, Max: max})
+}
+
+// Returns the number of points inside the region. When the region is a ContainingRegion,
+// subtrees whose ball lies wholly inside it are counted from their cached size without being
+// visited.
+func (tree BallTree) CountRegion(region common.Region) (int, error) {
+	count, err := tree.weighRegion(region, false)
+	return int(count), err
+}
+
+// Returns the total weight of the points inside the region, as given by common.Weight. Cached
+// subtree weights are used just as CountRegion uses cached sizes.
+func (tree BallTree) WeightedCountRegion(region common.Region) (float64, error) {
+	return tree.weighRegion(region, true)
+}
+
+// Counts the points inside the region, or sums their weights
+func (tree BallTree) weighRegion(region common.Region, weighted bool) (float64, error) {
+	if err := common.CheckRegion(region, tree.Dimension); err != nil {
+		return 0, err
+	}
+	if tree.Root == nil {
+		return 0, nil
+	}
+	containing, _ := region.(common.ContainingRegion)
+	return tree.countRegion(region, containing, weighted), nil
+}
+
+func (tree *BallTree) countRegion(region common.Region, containing common.ContainingRegion, weighted bool) float64 {
+	if !region.IntersectsBall(tree.Root.Centroid, tree.Root.Radius) {
+		return 0
+	}
+	if containing != nil && containing.ContainsBall(tree.Root.Centroid, tree.Root.Radius) {
+		if weighted {
+			return tree.weight()
+		}
+		return float64(tree.Size())
+	}
+	count := 0.
+	if region.Contains(tree.Root.Data.Vector()) {
+		count += pointWeight(tree.Root.Data, weighted)
+	}
+	if tree.Left != nil {
+		count += tree.Left.countRegion(region, containing, weighted)
+	}
+	if tree.Right != nil {
+		count += tree.Right.countRegion(region, containing, weighted)
+	}
+	return count
+}
+
+func checkBox(min, max common.PointVector, dimension int) error {
+	if err := common.CheckDimension("box's lower corner", len(min), dimension); err != nil {
+		return err
+	}
+	return common.CheckDimension("box's upper corner", len(max), dimension)
+}
+
+// The weight of a point, or one when counting
+func pointWeight(p common.Point, weighted bool) float64 {
+	if weighted {
+		return common.Weight(p)
+	}
+	return 1
+}
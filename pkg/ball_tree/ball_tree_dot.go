@@ -0,0 +1,24 @@
+package balltree
+
+import (
+	"io"
+	"strings"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Writes the tree as a Graphviz digraph, labelling each node with the centroid and radius of
+// its ball
+func (tree BallTree) WriteDOT(w io.Writer, options common.DOTOptions) error {
+	return common.WriteDOT(w, "BallTree", &tree, options, func(node common.Subtree) []string {
+		root := node.(*BallTree).Root
+		return []string{"centroid " + common.FormatVector(root.Centroid), "radius " + common.FormatFloat(root.Radius)}
+	})
+}
+
+// Returns the digraph written by WriteDOT
+func (tree BallTree) DOT(options common.DOTOptions) (string, error) {
+	var builder strings.Builder
+	err := tree.WriteDOT(&builder, options)
+	return builder.String(), err
+}
@@ -0,0 +1,36 @@
+package balltree
+
+import "github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+
+// Constructs the tree from raw vectors, each wrapped in a common.IndexedPoint whose ID is its
+// index, so that the ID queries return indices into the input. The dimension is that of the
+// first vector.
+func (tree *BallTree) ConstructIndexed(vectors [][]float64, options ...common.ConstructOption) error {
+	return common.ConstructIndexed(tree, vectors, options...)
+}
+
+// Returns the IDs of the points strictly within distance of the query vector. The points must
+// all be IdentifiedPoints.
+func (tree BallTree) SearchIDs(vector common.PointVector, distance float64) ([]int, error) {
+	return common.SearchIDs(&tree, vector, distance)
+}
+
+// Returns the IDs of the k points nearest to the query vector, nearest first. The points must
+// all be IdentifiedPoints.
+func (tree BallTree) KNearestNeighborIDs(vector common.PointVector, k int) ([]int, error) {
+	return common.KNearestNeighborIDs(&tree, vector, k)
+}
+
+// Returns the IdentifiedPoint of the tree with the given ID
+func (tree BallTree) Lookup(id int) (common.Point, bool) {
+	return tree.ids.Lookup(id, tree.Points)
+}
+
+// Removes the point with the given ID, returning whether there was one
+func (tree *BallTree) DeleteID(id int) (bool, error) {
+	p, ok := tree.Lookup(id)
+	if !ok {
+		return false, nil
+	}
+	return tree.Delete(p)
+}
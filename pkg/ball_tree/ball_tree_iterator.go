@@ -0,0 +1,31 @@
+package balltree
+
+import (
+	"math"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Returns an iterator over every point of the tree in increasing distance from the query point.
+// Points are found lazily, so the cost depends on how many are consumed.
+func (tree BallTree) NearestNeighborIterator(point common.Point) (*common.NeighborIterator, error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return nil, err
+	}
+	pointVector := point.Vector()
+	expand := func(node any, visit func(any, float64), emit func(common.Point, float64)) {
+		subtree := node.(*BallTree)
+		d, _ := common.Distance(pointVector, subtree.Root.Data.Vector())
+		emit(subtree.Root.Data, d)
+		for _, child := range []*BallTree{subtree.Left, subtree.Right} {
+			if child != nil {
+				d, _ := common.Distance(pointVector, child.Root.Centroid)
+				visit(child, math.Max(0, d-child.Root.Radius))
+			}
+		}
+	}
+	if tree.Root == nil {
+		return common.NewNeighborIterator(nil, expand), nil
+	}
+	return common.NewNeighborIterator(&tree, expand), nil
+}
@@ -6,6 +6,12 @@ type BallTreeNode struct {
 	Centroid common.PointVector `json:"Centroid"`
 	Data     common.Point       `json:"Data"`
 	Radius   float64            `json:"Radius"`
+	// The number of points in the subtree, or zero if unknown
+	SubtreeSize int `json:"SubtreeSize"`
+	// The total weight of the points in the subtree, as given by common.Weight
+	SubtreeWeight float64 `json:"SubtreeWeight"`
+	// The aggregate of the points of the subtree, if the tree was built with one
+	Aggregate any `json:"-"`
 }
 
 // Triangle inequality - query the children only if the distance between query points minus
@@ -0,0 +1,32 @@
+package balltree
+
+import "github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+
+// Returns every point of the tree lying inside the region. Subtrees are pruned
+// when the region misses their bounding ball.
+func (tree BallTree) QueryRegion(region common.Region) ([]common.Point, error) {
+	if err := common.CheckRegion(region, tree.Dimension); err != nil {
+		return nil, err
+	}
+	result := []common.Point{}
+	if tree.Root == nil {
+		return result, nil
+	}
+	return tree.queryRegion(region, result), nil
+}
+
+func (tree *BallTree) queryRegion(region common.Region, result []common.Point) []common.Point {
+	if !region.IntersectsBall(tree.Root.Centroid, tree.Root.Radius) {
+		return result
+	}
+	if region.Contains(tree.Root.Data.Vector()) {
+		result = append(result, tree.Root.Data)
+	}
+	if tree.Left != nil {
+		result = tree.Left.queryRegion(region, result)
+	}
+	if tree.Right != nil {
+		result = tree.Right.queryRegion(region, result)
+	}
+	return result
+}
@@ -0,0 +1,39 @@
+//go:build go1.23
+
+package balltree
+
+import (
+	"iter"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Returns an iterator over the points within distance of the query point, for use with range.
+// Points are found lazily, so breaking out of the loop stops the traversal.
+func (tree BallTree) SearchSeq(point common.Point, distance float64) (iter.Seq[common.Point], error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return nil, err
+	}
+	if err := common.CheckRadius(distance); err != nil {
+		return nil, err
+	}
+	return func(yield func(common.Point) bool) {
+		tree.SearchFunc(point, distance, yield)
+	}, nil
+}
+
+// Returns an iterator over every point of the tree and its distance from the query point,
+// in increasing order of distance.
+func (tree BallTree) NearestNeighborSeq(point common.Point) (iter.Seq2[common.Point, float64], error) {
+	it, err := tree.NearestNeighborIterator(point)
+	if err != nil {
+		return nil, err
+	}
+	return func(yield func(common.Point, float64) bool) {
+		for p, d, ok := it.Next(); ok; p, d, ok = it.Next() {
+			if !yield(p, d) {
+				return
+			}
+		}
+	}, nil
+}
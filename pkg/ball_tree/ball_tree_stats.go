@@ -0,0 +1,87 @@
+package balltree
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// The number of points sampled to estimate the overlap of each pair of sibling balls
+const overlapSamples = 64
+
+type BallTreeStats struct {
+	common.TreeStats
+	Radii common.Distribution
+	// The estimated fraction of the smaller ball of each pair of siblings lying inside the other
+	SiblingOverlap common.Distribution
+	// The estimated volume shared by each pair of sibling balls
+	SiblingOverlapVolume common.Distribution
+}
+
+// Describes the shape of the tree, the sizes of its balls and how much sibling balls overlap.
+// Overlaps are estimated by sampling from a fixed seed, so the same tree always gives the same
+// report.
+func (tree BallTree) Stats() BallTreeStats {
+	result := BallTreeStats{TreeStats: common.NewTreeStats(&tree)}
+	if tree.Root == nil {
+		return result
+	}
+	radii, overlaps, volumes := []float64{}, []float64{}, []float64{}
+	random := rand.New(rand.NewSource(1))
+	stack := []*BallTree{&tree}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		radii = append(radii, node.Root.Radius)
+		if node.Left != nil && node.Right != nil {
+			fraction, volume := overlap(node.Left.Root, node.Right.Root, random)
+			overlaps = append(overlaps, fraction)
+			volumes = append(volumes, volume)
+		}
+		for _, child := range []*BallTree{node.Right, node.Left} {
+			if child != nil {
+				stack = append(stack, child)
+			}
+		}
+	}
+	result.Radii = common.NewDistribution(radii)
+	result.SiblingOverlap = common.NewDistribution(overlaps)
+	result.SiblingOverlapVolume = common.NewDistribution(volumes)
+	return result
+}
+
+// Estimates the fraction of the smaller ball lying inside the larger by sampling the smaller
+// uniformly, returning it with the volume of the overlap
+func overlap(a, b *BallTreeNode, random *rand.Rand) (float64, float64) {
+	if a.Radius > b.Radius {
+		a, b = b, a
+	}
+	dimension := len(a.Centroid)
+	volume := math.Pow(math.Pi, float64(dimension)/2) / math.Gamma(float64(dimension)/2+1) * math.Pow(a.Radius, float64(dimension))
+	d, _ := common.Distance(a.Centroid, b.Centroid)
+	if d >= a.Radius+b.Radius {
+		return 0, 0
+	} else if d+a.Radius <= b.Radius {
+		return 1, volume
+	}
+	inside := 0
+	sample := make(common.PointVector, dimension)
+	for i := 0; i < overlapSamples; i++ {
+		// A uniform direction, at a radius weighted towards the surface as volume is
+		norm := 0.
+		for j := range sample {
+			sample[j] = random.NormFloat64()
+			norm += sample[j] * sample[j]
+		}
+		scale := a.Radius * math.Pow(random.Float64(), 1/float64(dimension)) / math.Sqrt(norm)
+		for j := range sample {
+			sample[j] = a.Centroid[j] + sample[j]*scale
+		}
+		if d, _ := common.Distance(sample, b.Centroid); d <= b.Radius {
+			inside++
+		}
+	}
+	fraction := float64(inside) / overlapSamples
+	return fraction, fraction * volume
+}
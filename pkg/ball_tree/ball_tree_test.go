@@ -1,8 +1,12 @@
 package balltree_test
 
 import (
+	"encoding/json"
 	"math"
 	"math/rand"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
 	balltree "github.com/KrishanBhalla/space-partitioning-trees/pkg/ball_tree"
@@ -94,3 +98,983 @@ func TestCanSearchTreeForNearestNeighbours(t *testing.T) {
 	assert.NotEmpty(t, result, "Expecting a non empty KNN result")
 	assert.Len(t, result, k, "Expecting to return exactly k neighbours. Expected %d, recieved %d", k, len(result))
 }
+
+func testRegions(dimension int) map[string]common.Region {
+	centre := make(common.PointVector, dimension)
+	min := make(common.PointVector, dimension)
+	max := make(common.PointVector, dimension)
+	normal := make(common.PointVector, dimension)
+	for i := range centre {
+		centre[i] = 100
+		min[i] = 50
+		max[i] = 120
+		normal[i] = float64(i + 1)
+	}
+	sphere := common.Sphere{Centre: centre, Radius: 60}
+	box := common.Box{Min: min, Max: max}
+	halfSpace := common.HalfSpace{Normal: normal, Offset: 400}
+	return map[string]common.Region{
+		"sphere":       sphere,
+		"box":          box,
+		"annulus":      common.Annulus{Centre: centre, InnerRadius: 30, OuterRadius: 70},
+		"halfSpace":    halfSpace,
+		"polytope":     common.ConvexPolytope{Faces: []common.HalfSpace{halfSpace, {Normal: common.PointVector{-1, 0, 1}, Offset: 10}}},
+		"union":        common.Union{sphere, box},
+		"intersection": common.Intersection{sphere, halfSpace},
+		"complement":   common.Complement{Region: sphere},
+	}
+}
+
+func TestCanQueryTreeByRegion(t *testing.T) {
+	nPoints := 2000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	for name, region := range testRegions(dimension) {
+		expected := common.Filter(points, func(p common.Point) bool { return region.Contains(p.Vector()) })
+		result, err := tree.QueryRegion(region)
+		assert.Nil(t, err, "No error should be returned")
+		assert.ElementsMatch(t, expected, result, "Expecting the %s query to match a brute force scan", name)
+	}
+	_, err := tree.QueryRegion(common.Sphere{Centre: common.PointVector{0, 0}, Radius: 1})
+	assert.NotNil(t, err, "Expecting an error for a region of the wrong dimension")
+
+	regions := testRegions(dimension)
+	flat := common.Sphere{Centre: common.PointVector{0, 0}, Radius: 1}
+	mixed := map[string]common.Region{
+		"union":        common.Union{regions["box"], flat},
+		"intersection": common.Intersection{regions["sphere"], flat},
+		"complement":   common.Complement{Region: common.Union{regions["sphere"], flat}},
+	}
+	assert.Equal(t, -1, mixed["union"].Dimension(), "Expecting no shared dimension for regions of mixed dimension")
+	for name, region := range mixed {
+		_, err = tree.QueryRegion(region)
+		assert.ErrorIs(t, err, common.ErrDimensionMismatch, "Expecting the %s query to reject regions of mixed dimension", name)
+		_, err = tree.CountRegion(region)
+		assert.ErrorIs(t, err, common.ErrDimensionMismatch, "Expecting the %s count to reject regions of mixed dimension", name)
+	}
+}
+
+func createStarRing(centre common.PointVector, nVertices int, minRadius, maxRadius float64) []common.PointVector {
+	ring := make([]common.PointVector, nVertices)
+	for i := range ring {
+		angle := 2 * math.Pi * float64(i) / float64(nVertices)
+		r := minRadius + rand.Float64()*(maxRadius-minRadius)
+		ring[i] = common.PointVector{centre[0] + r*math.Cos(angle), centre[1] + r*math.Sin(angle)}
+	}
+	return ring
+}
+
+func TestCanQueryTreeByPolygon(t *testing.T) {
+	nPoints := 1000
+	dimension := 2
+	points := createPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	for i := 0; i < 10; i++ {
+		centre := common.PointVector{50 + rand.Float64()*100, 50 + rand.Float64()*100}
+		outer := createStarRing(centre, 5+rand.Intn(20), 40, 90)
+		hole := createStarRing(centre, 3+rand.Intn(10), 5, 35)
+		polygon, err := common.NewPolygon(outer, hole)
+		assert.Nil(t, err, "No error should be returned")
+		expected := common.Filter(points, func(p common.Point) bool { return polygon.Contains(p.Vector()) })
+		result, err := tree.QueryRegion(polygon)
+		assert.Nil(t, err, "No error should be returned")
+		assert.NotEmpty(t, result, "Expecting a non empty polygon query result")
+		assert.ElementsMatch(t, expected, result, "Expecting the polygon query to match a brute force scan")
+	}
+
+	result, err := tree.QueryRegion(common.Polygon{})
+	assert.Nil(t, err, "No error should be returned")
+	assert.Empty(t, result, "Expecting the zero polygon to contain no points")
+	count, err := tree.CountRegion(common.Complement{Region: common.Polygon{}})
+	assert.Nil(t, err, "No error should be returned")
+	assert.Equal(t, nPoints, count, "Expecting the complement of the zero polygon to contain every point")
+}
+
+func TestCanStreamSearchResults(t *testing.T) {
+	nPoints := 1000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	testPoint := createPoint(dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	expected, _ := tree.Search(testPoint, 80)
+	streamed := []common.Point{}
+	err := tree.SearchFunc(testPoint, 80, func(p common.Point) bool {
+		streamed = append(streamed, p)
+		return true
+	})
+	assert.Nil(t, err, "No error should be returned")
+	assert.ElementsMatch(t, expected, streamed, "Expecting the streamed results to match Search")
+
+	calls := 0
+	err = tree.SearchFunc(testPoint, 500, func(p common.Point) bool {
+		calls++
+		return false
+	})
+	assert.Nil(t, err, "No error should be returned")
+	assert.Equal(t, 1, calls, "Expecting traversal to stop once the callback returns false")
+}
+
+func TestCanIterateNearestNeighboursInOrder(t *testing.T) {
+	nPoints := 1000
+	dimension := 3
+	k := 25
+	points := createPoints(nPoints, dimension, -100, 100)
+	testPoint := createPoint(dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	expected := append([]common.Point{}, points...)
+	sort.Slice(expected, func(i, j int) bool {
+		di, _ := common.Distance(expected[i].Vector(), testPoint.Vector())
+		dj, _ := common.Distance(expected[j].Vector(), testPoint.Vector())
+		return di < dj
+	})
+
+	it, err := tree.NearestNeighborIterator(testPoint)
+	assert.Nil(t, err, "No error should be returned")
+	previous := 0.
+	result := []common.Point{}
+	for p, d, ok := it.Next(); ok; p, d, ok = it.Next() {
+		assert.GreaterOrEqual(t, d, previous, "Expecting points in increasing distance from the query")
+		previous = d
+		result = append(result, p)
+	}
+	assert.Len(t, result, nPoints, "Expecting the iterator to visit every point")
+	assert.Equal(t, expected[:k], result[:k], "Expecting the first k points to be the k nearest neighbours")
+}
+
+// Distance from p to its k-th nearest neighbour among candidates, ignoring p itself
+func bruteForceKNearestRadius(p common.Point, candidates []common.Point, k int) float64 {
+	distances := []float64{}
+	for _, c := range candidates {
+		if c != p {
+			d, _ := common.Distance(p.Vector(), c.Vector())
+			distances = append(distances, d)
+		}
+	}
+	if len(distances) < k {
+		return math.Inf(1)
+	}
+	sort.Float64s(distances)
+	return distances[k-1]
+}
+
+func TestKNearestNeighboursAreExact(t *testing.T) {
+	nPoints := 1000
+	dimension := 3
+	k := 10
+	points := createPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	for i := 0; i < 20; i++ {
+		testPoint := createPoint(dimension, -100, 100)
+		result, err := tree.KNearestNeighbors(testPoint, k)
+		assert.Nil(t, err, "No error should be returned")
+		assert.Len(t, result, k, "Expecting to return exactly k neighbours")
+		d, _ := common.Distance(testPoint.Vector(), result[k-1].Vector())
+		assert.Equal(t, bruteForceKNearestRadius(testPoint, points, k), d, "Expecting the k-th neighbour to match a brute force scan")
+	}
+	result, _ := tree.KNearestNeighbors(points[0], 2*nPoints)
+	assert.Len(t, result, nPoints, "Expecting every point when k exceeds the tree size")
+}
+
+func TestCanFindReverseNearestNeighbours(t *testing.T) {
+	nPoints := 500
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	for _, k := range []int{1, 5} {
+		for i := 0; i < 5; i++ {
+			testPoint := createPoint(dimension, -100, 100)
+			expected := common.Filter(points, func(p common.Point) bool {
+				d, _ := common.Distance(p.Vector(), testPoint.Vector())
+				return d <= bruteForceKNearestRadius(p, points, k)
+			})
+			result, err := tree.ReverseKNearestNeighbors(testPoint, k)
+			assert.Nil(t, err, "No error should be returned")
+			assert.ElementsMatch(t, expected, result, "Expecting reverse neighbours to match a brute force scan")
+		}
+	}
+
+	// An index may be shared between concurrent queries
+	index, err := tree.ReverseNeighborIndex(3)
+	assert.Nil(t, err, "No error should be returned")
+	queries := createPoints(8, dimension, -100, 100)
+	results := make([][]common.Point, len(queries))
+	var wg sync.WaitGroup
+	for i, q := range queries {
+		wg.Add(1)
+		go func(i int, q common.Point) {
+			defer wg.Done()
+			results[i], _ = index.ReverseKNearestNeighbors(q)
+		}(i, q)
+	}
+	wg.Wait()
+	for i, q := range queries {
+		expected, _ := tree.ReverseKNearestNeighbors(q, 3)
+		assert.ElementsMatch(t, expected, results[i], "Expecting the index to give the same answers")
+	}
+}
+
+func TestCanFindBichromaticReverseNearestNeighbours(t *testing.T) {
+	dimension := 3
+	k := 3
+	points := createPoints(500, dimension, -100, 100)
+	facilityPoints := createPoints(50, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	facilities := balltree.BallTree{}
+	facilities.Construct(facilityPoints, dimension)
+	for i := 0; i < 5; i++ {
+		testPoint := createPoint(dimension, -100, 100)
+		expected := common.Filter(points, func(p common.Point) bool {
+			d, _ := common.Distance(p.Vector(), testPoint.Vector())
+			return d <= bruteForceKNearestRadius(p, facilityPoints, k)
+		})
+		result, err := tree.BichromaticReverseKNearestNeighbors(testPoint, k, &facilities)
+		assert.Nil(t, err, "No error should be returned")
+		assert.NotEmpty(t, result, "Expecting a non empty reverse neighbour result")
+		assert.ElementsMatch(t, expected, result, "Expecting bichromatic reverse neighbours to match a brute force scan")
+	}
+
+	// An index describes the facilities as they were when it was built
+	query := createPoint(dimension, -100, 100)
+	before, err := tree.BichromaticReverseNeighborIndex(1, &facilities)
+	assert.Nil(t, err, "No error should be returned")
+	added := &testPoint{dimension: dimension, vector: append(common.PointVector{}, query.Vector()...)}
+	assert.Nil(t, facilities.Insert(added), "No error should be returned")
+	after, err := tree.BichromaticReverseNeighborIndex(1, &facilities)
+	assert.Nil(t, err, "No error should be returned")
+	for index, candidates := range map[*balltree.ReverseNeighborIndex][]common.Point{before: facilityPoints, after: append(facilityPoints, added)} {
+		expected := common.Filter(points, func(p common.Point) bool {
+			d, _ := common.Distance(p.Vector(), query.Vector())
+			return d <= bruteForceKNearestRadius(p, candidates, 1)
+		})
+		result, err := index.ReverseKNearestNeighbors(query)
+		assert.Nil(t, err, "No error should be returned")
+		assert.ElementsMatch(t, expected, result, "Expecting each index to match a brute force scan of its facilities")
+	}
+}
+
+func TestCanFindClosestPairs(t *testing.T) {
+	nPoints := 500
+	dimension := 3
+	k := 20
+	points := createPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	expected := []float64{}
+	for i, a := range points {
+		for _, b := range points[i+1:] {
+			d, _ := common.Distance(a.Vector(), b.Vector())
+			expected = append(expected, d)
+		}
+	}
+	sort.Float64s(expected)
+	result, err := tree.ClosestPairs(k)
+	assert.Nil(t, err, "No error should be returned")
+	assert.Len(t, result, k, "Expecting exactly k pairs")
+	for i, pair := range result {
+		assert.NotSame(t, pair.A, pair.B, "Expecting pairs of distinct points")
+		d, _ := common.Distance(pair.A.Vector(), pair.B.Vector())
+		assert.Equal(t, d, pair.Distance, "Expecting the reported distance to match the pair")
+		assert.Equal(t, expected[i], pair.Distance, "Expecting the closest pairs to match a brute force scan")
+	}
+
+	otherPoints := createPoints(300, dimension, -100, 100)
+	other := balltree.BallTree{}
+	other.Construct(otherPoints, dimension)
+	expected = []float64{}
+	for _, a := range points {
+		for _, b := range otherPoints {
+			d, _ := common.Distance(a.Vector(), b.Vector())
+			expected = append(expected, d)
+		}
+	}
+	sort.Float64s(expected)
+	result, err = tree.ClosestPairsWith(&other, k)
+	assert.Nil(t, err, "No error should be returned")
+	assert.Equal(t, expected[:k], common.Map(result, func(p common.PointPair) float64 { return p.Distance }), "Expecting the closest pairs across trees to match a brute force scan")
+}
+
+func TestCanFindMinimumSpanningTree(t *testing.T) {
+	nPoints := 300
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	result, err := tree.MinimumSpanningTree()
+	assert.Nil(t, err, "No error should be returned")
+	assert.Len(t, result.Edges, nPoints-1, "Expecting a spanning tree to have one edge fewer than it has points")
+
+	// Prim's algorithm over the complete graph
+	best := make([]float64, nPoints)
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+	expected, current := 0., 0
+	for added := 1; added < nPoints; added++ {
+		best[current] = -1
+		next := -1
+		for i, p := range points {
+			if best[i] >= 0 {
+				d, _ := common.Distance(points[current].Vector(), p.Vector())
+				best[i] = math.Min(best[i], d)
+				if next < 0 || best[i] < best[next] {
+					next = i
+				}
+			}
+		}
+		expected += best[next]
+		current = next
+	}
+	actual := 0.
+	for _, e := range result.Edges {
+		actual += e.Weight
+	}
+	assert.InDelta(t, expected, actual, 1e-6, "Expecting the spanning tree to have minimum weight")
+}
+
+func TestCanCountPoints(t *testing.T) {
+	nPoints := 5000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	assert.Equal(t, nPoints, tree.Size(), "Expecting the cached size to count every point")
+	for i := 0; i < 20; i++ {
+		query := createPoint(dimension, -100, 100)
+		radius := rand.Float64() * 150
+		expected, _ := tree.Search(query, radius)
+		count, err := tree.Count(query, radius)
+		assert.Nil(t, err, "No error should be returned")
+		assert.Equal(t, len(expected), count, "Expecting the count to match the search")
+
+		min := createPoint(dimension, -150, 50).Vector()
+		max := append(common.PointVector{}, min...)
+		for j := range max {
+			max[j] += rand.Float64() * 150
+		}
+		box := common.Box{Min: min, Max: max}
+		count, err = tree.CountBox(min, max)
+		assert.Nil(t, err, "No error should be returned")
+		assert.Equal(t, len(common.Filter(points, func(p common.Point) bool { return box.Contains(p.Vector()) })), count, "Expecting the box count to match a brute force scan")
+	}
+	for name, region := range testRegions(dimension) {
+		count, err := tree.CountRegion(region)
+		assert.Nil(t, err, "No error should be returned")
+		assert.Equal(t, len(common.Filter(points, func(p common.Point) bool { return region.Contains(p.Vector()) })), count, "Expecting the %s count to match a brute force scan", name)
+	}
+
+	planar := createPoints(nPoints, 2, -100, 100)
+	planarTree := balltree.BallTree{}
+	planarTree.Construct(planar, 2)
+	for i := 0; i < 10; i++ {
+		centre := common.PointVector{rand.Float64() * 50, rand.Float64() * 50}
+		polygon, _ := common.NewPolygon(createStarRing(centre, 5+rand.Intn(20), 40, 90), createStarRing(centre, 3+rand.Intn(10), 5, 35))
+		for name, region := range map[string]common.Region{"polygon": polygon, "complement": common.Complement{Region: polygon}} {
+			count, err := planarTree.CountRegion(region)
+			assert.Nil(t, err, "No error should be returned")
+			assert.Equal(t, len(common.Filter(planar, func(p common.Point) bool { return region.Contains(p.Vector()) })), count, "Expecting the %s count to match a brute force scan", name)
+		}
+	}
+
+	_, err := tree.Count(createPoint(2, 0, 1), 1)
+	assert.NotNil(t, err, "Expecting an error for a query point of the wrong dimension")
+	_, err = tree.CountBox(common.PointVector{0, 0}, common.PointVector{1, 1, 1})
+	assert.NotNil(t, err, "Expecting an error for mismatched box corners")
+	count, err := (&balltree.BallTree{Dimension: dimension}).Count(createPoint(dimension, 0, 1), 1)
+	assert.Nil(t, err, "No error should be returned")
+	assert.Equal(t, 0, count, "Expecting an empty tree to hold no points")
+
+	// Sizes which are not cached are counted instead
+	tree.Root.SubtreeSize = 0
+	assert.Equal(t, nPoints, tree.Size(), "Expecting the size to be counted when not cached")
+}
+func testAggregates() map[string]common.Aggregate {
+	first := func(p common.Point) float64 { return p.Vector()[0] }
+	return map[string]common.Aggregate{
+		"sum":  common.SumAggregate(first),
+		"min":  common.MinAggregate(first),
+		"max":  common.MaxAggregate(first),
+		"mean": common.MeanAggregate(first),
+	}
+}
+
+// Folds the aggregate over the points of the region one at a time, reducing the result to a float
+func bruteForceAggregate(aggregate common.Aggregate, points []common.Point, region common.Region) float64 {
+	result := aggregate.Identity
+	for _, p := range points {
+		if region.Contains(p.Vector()) {
+			result = aggregate.Combine(result, aggregate.Lift(p))
+		}
+	}
+	return aggregateValue(result)
+}
+
+func aggregateValue(value any) float64 {
+	if mean, ok := value.(common.Mean); ok {
+		return mean.Value()
+	}
+	return value.(float64)
+}
+
+func TestCanAggregateRegions(t *testing.T) {
+	nPoints := 5000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	for name, aggregate := range testAggregates() {
+		tree := balltree.BallTree{}
+		tree.Construct(points, dimension, common.WithAggregate(aggregate))
+		for regionName, region := range testRegions(dimension) {
+			value, err := tree.AggregateRegion(region)
+			assert.Nil(t, err, "No error should be returned")
+			assert.InDelta(t, bruteForceAggregate(aggregate, points, region), aggregateValue(value), 1e-6, "Expecting the %s over the %s to match a brute force scan", name, regionName)
+		}
+		value, err := tree.AggregateRegion(common.Complement{Region: common.Sphere{Centre: make(common.PointVector, dimension), Radius: math.Inf(1)}})
+		assert.Nil(t, err, "No error should be returned")
+		assert.Equal(t, aggregate.Identity, value, "Expecting an empty region to give the identity")
+	}
+
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	_, err := tree.AggregateRegion(testRegions(dimension)["sphere"])
+	assert.NotNil(t, err, "Expecting an error for a tree constructed without an aggregate")
+	tree.Construct(points, dimension, common.WithAggregate(common.SumAggregate(func(p common.Point) float64 { return 1 })))
+	_, err = tree.AggregateRegion(common.Sphere{Centre: common.PointVector{0, 0}, Radius: 1})
+	assert.NotNil(t, err, "Expecting an error for a region of the wrong dimension")
+}
+
+func TestCanInsertAndDeletePoints(t *testing.T) {
+	nPoints := 2000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	// Coarse values give points sharing split values
+	for _, p := range points[:nPoints/4] {
+		for i := range p.Vector() {
+			p.Vector()[i] = math.Round(p.Vector()[i] / 20)
+		}
+	}
+	count := common.SumAggregate(func(p common.Point) float64 { return 1 })
+	sum := common.SumAggregate(func(p common.Point) float64 { return p.Vector()[1] })
+	tree := balltree.BallTree{}
+	tree.Construct(points[:nPoints/2], dimension, common.WithAggregate(sum))
+	held := append([]common.Point{}, points[:nPoints/2]...)
+	pending := append([]common.Point{}, points[nPoints/2:]...)
+	for step := 0; step < 3000; step++ {
+		if len(pending) > 0 && (len(held) == 0 || rand.Intn(2) == 0) {
+			i := rand.Intn(len(pending))
+			assert.Nil(t, tree.Insert(pending[i]), "No error should be returned")
+			held = append(held, pending[i])
+			pending = append(pending[:i], pending[i+1:]...)
+		} else {
+			i := rand.Intn(len(held))
+			removed, err := tree.Delete(held[i])
+			assert.Nil(t, err, "No error should be returned")
+			assert.True(t, removed, "Expecting a held point to be removed")
+			pending = append(pending, held[i])
+			held = append(held[:i], held[i+1:]...)
+		}
+		if step%250 != 0 {
+			continue
+		}
+		treeSizeValidator(t, len(held), &tree)
+		assert.ElementsMatch(t, held, tree.Points(), "Expecting the tree to hold exactly the inserted points")
+		query := createPoint(dimension, -100, 100)
+		result, _ := tree.Search(query, 50)
+		expected := common.Filter(held, func(p common.Point) bool {
+			d, _ := common.Distance(p.Vector(), query.Vector())
+			return d < 50
+		})
+		assert.ElementsMatch(t, expected, result, "Expecting the search to match a brute force scan")
+		if len(held) >= 5 {
+			neighbours, _ := tree.KNearestNeighbors(query, 5)
+			d, _ := common.Distance(neighbours[4].Vector(), query.Vector())
+			assert.InDelta(t, bruteForceKNearestRadius(query, held, 5), d, 1e-9, "Expecting the nearest neighbours to match a brute force scan")
+		}
+		for name, region := range testRegions(dimension) {
+			value, err := tree.AggregateRegion(region)
+			assert.Nil(t, err, "No error should be returned")
+			assert.InDelta(t, bruteForceAggregate(sum, held, region), value.(float64), 1e-6, "Expecting the %s aggregate to match a brute force scan", name)
+			n, _ := tree.CountRegion(region)
+			assert.Equal(t, int(bruteForceAggregate(count, held, region)), n, "Expecting the %s count to match a brute force scan", name)
+		}
+	}
+
+	removed, err := tree.Delete(createPoint(dimension, -100, 100))
+	assert.Nil(t, err, "No error should be returned")
+	assert.False(t, removed, "Expecting a point not in the tree not to be removed")
+	_, err = tree.Delete(createPoint(2, -100, 100))
+	assert.NotNil(t, err, "Expecting an error for a point of the wrong dimension")
+	assert.NotNil(t, tree.Insert(createPoint(2, -100, 100)), "Expecting an error for a point of the wrong dimension")
+	for _, p := range held {
+		tree.Delete(p)
+	}
+	treeSizeValidator(t, 0, &tree)
+
+	empty := balltree.BallTree{}
+	for _, p := range points[:100] {
+		assert.Nil(t, empty.Insert(p), "No error should be returned")
+	}
+	treeSizeValidator(t, 100, &empty)
+	assert.Equal(t, dimension, empty.NodeDimension(), "Expecting an empty tree to take the dimension of its first point")
+
+	// Points which cannot be compared are matched by coordinates, and duplicates one at a time
+	values := []common.Point{}
+	for _, p := range points[:50] {
+		values = append(values, valuePoint{p.Vector()}, valuePoint{p.Vector()})
+	}
+	byValue := balltree.BallTree{}
+	assert.Nil(t, byValue.Construct(values, dimension), "No error should be returned")
+	for i, p := range values {
+		removed, err := byValue.Delete(valuePoint{append(common.PointVector{}, p.Vector()...)})
+		assert.Nil(t, err, "No error should be returned")
+		assert.True(t, removed, "Expecting a point with the same coordinates to be removed")
+		treeSizeValidator(t, len(values)-i-1, &byValue)
+	}
+}
+
+// A point held by value, which cannot be compared as it holds a slice
+type valuePoint struct {
+	vector common.PointVector
+}
+
+func (v valuePoint) Dimension() int {
+	return len(v.vector)
+}
+
+func (v valuePoint) Vector() common.PointVector {
+	return v.vector
+}
+
+type weightedTestPoint struct {
+	testPoint
+	weight float64
+}
+
+func (t *weightedTestPoint) Weight() float64 {
+	return t.weight
+}
+
+func createWeightedPoints(nPoints, dimension int, lowerBound, upperBound float64) []common.Point {
+	result := make([]common.Point, nPoints)
+	for i := range result {
+		p := createPoint(dimension, lowerBound, upperBound).(*testPoint)
+		// A few heavy points pull the weighted medians away from the plain ones
+		weight := rand.Float64()
+		if i%50 == 0 {
+			weight = 20
+		}
+		result[i] = &weightedTestPoint{testPoint: *p, weight: weight}
+	}
+	return result
+}
+
+func TestCanCountWeightedPoints(t *testing.T) {
+	nPoints := 3000
+	dimension := 3
+	points := createWeightedPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	treeSizeValidator(t, nPoints, &tree)
+	total := common.Reduce(points, 0., func(w float64, p common.Point) float64 { return w + common.Weight(p) })
+	assert.InDelta(t, total, tree.Root.SubtreeWeight, 1e-6, "Expecting the root to cache the total weight")
+	// The root splits at the weighted median
+	assert.LessOrEqual(t, tree.Left.Root.SubtreeWeight, total/2, "Expecting at most half the weight left of the root")
+	assert.Greater(t, tree.Left.Root.SubtreeWeight+common.Weight(tree.Root.Data), total/2, "Expecting more than half the weight up to the root")
+
+	weigh := func(region common.Region) float64 {
+		return common.Reduce(points, 0., func(w float64, p common.Point) float64 {
+			if region.Contains(p.Vector()) {
+				return w + common.Weight(p)
+			}
+			return w
+		})
+	}
+	for name, region := range testRegions(dimension) {
+		weight, err := tree.WeightedCountRegion(region)
+		assert.Nil(t, err, "No error should be returned")
+		assert.InDelta(t, weigh(region), weight, 1e-6, "Expecting the %s weight to match a brute force scan", name)
+	}
+	query := createPoint(dimension, -100, 100)
+	weight, err := tree.WeightedCount(query, 60)
+	assert.Nil(t, err, "No error should be returned")
+	assert.InDelta(t, weigh(common.Sphere{Centre: query.Vector(), Radius: 60}), weight, 1e-6, "Expecting the weight within the radius to match a brute force scan")
+	min, max := common.PointVector{20, 40, 0}, common.PointVector{150, 120, 90}
+	weight, err = tree.WeightedCountBox(min, max)
+	assert.Nil(t, err, "No error should be returned")
+	assert.InDelta(t, weigh(common.Box{Min: min, Max: max}), weight, 1e-6, "Expecting the weight in the box to match a brute force scan")
+
+	// Unweighted points weigh one each
+	plain := createPoints(nPoints, dimension, -100, 100)
+	tree.Construct(plain, dimension)
+	for name, region := range testRegions(dimension) {
+		count, _ := tree.CountRegion(region)
+		weight, _ := tree.WeightedCountRegion(region)
+		assert.Equal(t, float64(count), weight, "Expecting the %s weight of unweighted points to be their count", name)
+	}
+
+	negative := createWeightedPoints(10, dimension, -100, 100)
+	negative[3].(*weightedTestPoint).weight = -1
+	assert.NotNil(t, tree.Construct(negative, dimension), "Expecting an error for a negative weight")
+
+	// Partitions weighing nothing are split by count
+	zeros := createWeightedPoints(3, dimension, -100, 100)
+	zeros[0].(*weightedTestPoint).weight = 0
+	zeros[1].(*weightedTestPoint).weight = 0
+	zeros[2].(*weightedTestPoint).weight = 5
+	assert.Nil(t, tree.Construct(zeros, dimension), "No error should be returned for zero weights")
+	treeSizeValidator(t, 3, &tree)
+	for _, p := range createWeightedPoints(100, dimension, -100, 100) {
+		p.(*weightedTestPoint).weight = 0
+		zeros = append(zeros, p)
+	}
+	assert.Nil(t, tree.Construct(zeros, dimension), "No error should be returned for zero weights")
+	treeSizeValidator(t, 103, &tree)
+	assert.Equal(t, 5.0, tree.Root.SubtreeWeight, "Expecting zero weights to add nothing")
+}
+func TestCanQueryByIndex(t *testing.T) {
+	nPoints := 2000
+	dimension := 3
+	vectors := make([][]float64, nPoints)
+	for i := range vectors {
+		vectors[i] = createPoint(dimension, -100, 100).Vector()
+	}
+	// Repeated vectors keep their own indices
+	vectors[10] = append([]float64{}, vectors[11]...)
+	tree := balltree.BallTree{}
+	assert.Nil(t, tree.ConstructIndexed(vectors), "No error should be returned")
+	treeSizeValidator(t, nPoints, &tree)
+
+	query := common.PointVector{100, 100, 100}
+	expected := []int{}
+	for i, v := range vectors {
+		if d, _ := common.Distance(v, query); d < 60 {
+			expected = append(expected, i)
+		}
+	}
+	indices, err := tree.SearchIDs(query, 60)
+	assert.Nil(t, err, "No error should be returned")
+	assert.ElementsMatch(t, expected, indices, "Expecting the search to return the indices of the matching vectors")
+
+	indices, err = tree.KNearestNeighborIDs(vectors[11], 2)
+	assert.Nil(t, err, "No error should be returned")
+	assert.ElementsMatch(t, []int{10, 11}, indices, "Expecting a repeated vector to be found under both indices")
+
+	p, ok := tree.Lookup(42)
+	assert.True(t, ok, "Expecting every index to be found")
+	assert.Equal(t, common.PointVector(vectors[42]), p.Vector(), "Expecting the lookup to find the vector at the index")
+	removed, err := tree.DeleteID(42)
+	assert.Nil(t, err, "No error should be returned")
+	assert.True(t, removed, "Expecting a held ID to be removed")
+	_, ok = tree.Lookup(42)
+	assert.False(t, ok, "Expecting a removed ID not to be found")
+	removed, _ = tree.DeleteID(42)
+	assert.False(t, removed, "Expecting a removed ID not to be removed again")
+	treeSizeValidator(t, nPoints-1, &tree)
+
+	assert.Nil(t, tree.Insert(&common.IndexedPoint{Index: 42, Coordinates: vectors[42]}), "No error should be returned")
+	_, ok = tree.Lookup(42)
+	assert.True(t, ok, "Expecting an inserted ID to be found")
+	assert.NotNil(t, tree.Insert(&common.IndexedPoint{Index: 7, Coordinates: vectors[7]}), "Expecting an error for a repeated ID")
+	treeSizeValidator(t, nPoints, &tree)
+
+	duplicated := common.IndexPoints(vectors[:10])
+	duplicated[3].(*common.IndexedPoint).Index = 4
+	assert.NotNil(t, tree.Construct(duplicated, dimension), "Expecting an error for a repeated ID")
+	treeSizeValidator(t, nPoints, &tree)
+
+	tree.Construct(createPoints(100, dimension, -100, 100), dimension)
+	_, err = tree.SearchIDs(query, 200)
+	assert.NotNil(t, err, "Expecting an error for points without IDs")
+	_, ok = tree.Lookup(0)
+	assert.False(t, ok, "Expecting points without IDs not to be found")
+}
+func TestCanDeleteByIDWithStaleCoordinates(t *testing.T) {
+	nPoints := 500
+	dimension := 3
+	vectors := make([][]float64, nPoints)
+	for i := range vectors {
+		vectors[i] = createPoint(dimension, -100, 100).Vector()
+	}
+	tree := balltree.BallTree{}
+	assert.Nil(t, tree.ConstructIndexed(vectors), "No error should be returned")
+	for _, id := range []int{0, 42, 499} {
+		stale := &common.IndexedPoint{Index: id, Coordinates: common.PointVector{1000, 1000, 1000}}
+		removed, err := tree.Delete(stale)
+		assert.Nil(t, err, "No error should be returned")
+		assert.True(t, removed, "Expecting a point to be found by its ID whatever the coordinates given")
+		_, ok := tree.Lookup(id)
+		assert.False(t, ok, "Expecting a removed ID not to be found")
+	}
+	treeSizeValidator(t, nPoints-3, &tree)
+	removed, _ := tree.Delete(&common.IndexedPoint{Index: 42, Coordinates: vectors[42]})
+	assert.False(t, removed, "Expecting a removed ID not to be removed again")
+}
+
+func TestCanRejectPointsOnConstruction(t *testing.T) {
+	nPoints := 500
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	points[3] = createPoint(2, -100, 100)
+	points[50] = createPoint(4, -100, 100)
+	points[70].Vector()[1] = math.NaN()
+	points[90].Vector()[2] = math.Inf(-1)
+	points[91].Vector()[0] = math.Inf(1)
+	expected := []common.Rejection{
+		{Index: 3, Reason: common.WrongDimension},
+		{Index: 50, Reason: common.WrongDimension},
+		{Index: 70, Reason: common.NonFiniteCoordinate},
+		{Index: 90, Reason: common.NonFiniteCoordinate},
+		{Index: 91, Reason: common.NonFiniteCoordinate},
+	}
+
+	tree := balltree.BallTree{}
+	err := tree.Construct(points, dimension, common.WithStrict())
+	var rejected *common.RejectedPointsError
+	assert.ErrorAs(t, err, &rejected, "Expecting strict construction to reject the points")
+	assert.Equal(t, expected, rejected.Rejections, "Expecting every offending index to be listed")
+
+	report := common.ConstructReport{}
+	assert.Nil(t, tree.Construct(points, dimension, common.WithPermissive(&report)), "No error should be returned")
+	treeSizeValidator(t, nPoints-5, &tree)
+	assert.Equal(t, nPoints-5, report.Accepted, "Expecting the report to count the accepted points")
+	assert.Equal(t, 5, report.Dropped(), "Expecting the report to count the dropped points")
+	assert.Equal(t, expected, report.Rejections, "Expecting the report to list the dropped points")
+	assert.Equal(t, map[common.RejectionReason]int{common.WrongDimension: 2, common.NonFiniteCoordinate: 3}, report.Counts(), "Expecting the report to count the reasons")
+
+	// By default only points of the wrong dimension are dropped
+	assert.Nil(t, tree.Construct(points, dimension), "No error should be returned")
+	treeSizeValidator(t, nPoints-2, &tree)
+
+	valid := createPoints(nPoints, dimension, -100, 100)
+	assert.Nil(t, tree.Construct(valid, dimension, common.WithStrict()), "No error should be returned")
+	treeSizeValidator(t, nPoints, &tree)
+}
+func TestReturnsTypedErrors(t *testing.T) {
+	dimension := 3
+	empty := balltree.BallTree{}
+	assert.Nil(t, empty.Construct([]common.Point{}, dimension), "No error should be returned")
+	query := createPoint(dimension, -100, 100)
+	_, err := empty.KNearestNeighbors(query, 1)
+	assert.ErrorIs(t, err, common.ErrEmptyTree, "Expecting nearest neighbours of an empty tree to be an error")
+	var zeroValue balltree.BallTree
+	_, err = zeroValue.KNearestNeighbors(query, 1)
+	assert.ErrorIs(t, err, common.ErrEmptyTree, "Expecting nearest neighbours of a zero value tree to be an error")
+	_, err = empty.KNearestNeighborIDs(query.Vector(), 1)
+	assert.ErrorIs(t, err, common.ErrEmptyTree, "Expecting nearest neighbours of an empty tree to be an error")
+	result, err := empty.Search(query, 10)
+	assert.Nil(t, err, "No error should be returned")
+	assert.Empty(t, result, "Expecting an empty tree to hold no points")
+	count, err := empty.CountBox(common.PointVector{0, 0, 0}, common.PointVector{1, 1, 1})
+	assert.Nil(t, err, "No error should be returned")
+	assert.Equal(t, 0, count, "Expecting an empty tree to hold no points")
+	result, err = empty.QueryRegion(testRegions(dimension)["complement"])
+	assert.Nil(t, err, "No error should be returned")
+	assert.Empty(t, result, "Expecting an empty tree to hold no points")
+	it, err := empty.NearestNeighborIterator(query)
+	assert.Nil(t, err, "No error should be returned")
+	_, _, ok := it.Next()
+	assert.False(t, ok, "Expecting an empty tree to hold no points")
+	pairs, err := empty.ClosestPairs(1)
+	assert.Nil(t, err, "No error should be returned")
+	assert.Empty(t, pairs, "Expecting an empty tree to hold no pairs")
+	assert.Equal(t, 0, empty.Depth(), "Expecting an empty tree to have no depth")
+	assert.Empty(t, empty.Points(), "Expecting an empty tree to hold no points")
+
+	points := createPoints(3, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	// More neighbours than points, some of whose children are missing
+	neighbours, err := tree.KNearestNeighbors(query, 10)
+	assert.Nil(t, err, "No error should be returned")
+	assert.ElementsMatch(t, points, neighbours, "Expecting every point when k exceeds the size of the tree")
+
+	wrong := createPoint(2, -100, 100)
+	region := common.Sphere{Centre: wrong.Vector(), Radius: 1}
+	other := balltree.BallTree{}
+	other.Construct([]common.Point{wrong}, 2)
+	_, searchErr := tree.Search(wrong, 1)
+	_, countErr := tree.Count(wrong, 1)
+	_, boxErr := tree.CountBox(common.PointVector{0, 0}, common.PointVector{1, 1})
+	_, regionErr := tree.CountRegion(region)
+	_, queryErr := tree.QueryRegion(region)
+	_, neighbourErr := tree.KNearestNeighbors(wrong, 1)
+	_, iteratorErr := tree.NearestNeighborIterator(wrong)
+	_, reverseErr := tree.ReverseKNearestNeighbors(wrong, 1)
+	_, facilitiesErr := tree.BichromaticReverseKNearestNeighbors(query, 1, &other)
+	_, pairsErr := tree.ClosestPairsWith(&other, 1)
+	_, deleteErr := tree.Delete(wrong)
+	for name, err := range map[string]error{
+		"Search":           searchErr,
+		"SearchFunc":       tree.SearchFunc(wrong, 1, func(common.Point) bool { return true }),
+		"Count":            countErr,
+		"CountBox":         boxErr,
+		"CountRegion":      regionErr,
+		"QueryRegion":      queryErr,
+		"KNearest":         neighbourErr,
+		"Iterator":         iteratorErr,
+		"Reverse":          reverseErr,
+		"Bichromatic":      facilitiesErr,
+		"ClosestPairsWith": pairsErr,
+		"Insert":           tree.Insert(wrong),
+		"Delete":           deleteErr,
+	} {
+		var dimensionErr *common.DimensionError
+		assert.ErrorIs(t, err, common.ErrDimensionMismatch, "Expecting %s to reject the wrong dimension", name)
+		assert.ErrorAs(t, err, &dimensionErr, "Expecting %s to report the dimensions", name)
+	}
+
+	_, neighbourErr = tree.KNearestNeighbors(query, 0)
+	_, idsErr := tree.KNearestNeighborIDs(query.Vector(), -1)
+	_, reverseErr = tree.ReverseKNearestNeighbors(query, 0)
+	_, pairsErr = tree.ClosestPairs(0)
+	for name, err := range map[string]error{"KNearest": neighbourErr, "KNearestIDs": idsErr, "Reverse": reverseErr, "ClosestPairs": pairsErr} {
+		var kErr *common.InvalidKError
+		assert.ErrorIs(t, err, common.ErrInvalidK, "Expecting %s to reject the k", name)
+		assert.ErrorAs(t, err, &kErr, "Expecting %s to report the k", name)
+	}
+
+	_, searchErr = tree.Search(query, -1)
+	_, countErr = tree.Count(query, math.NaN())
+	_, idsErr = tree.SearchIDs(query.Vector(), -1)
+	for name, err := range map[string]error{
+		"Search":     searchErr,
+		"SearchFunc": tree.SearchFunc(query, math.NaN(), func(common.Point) bool { return true }),
+		"Count":      countErr,
+		"SearchIDs":  idsErr,
+	} {
+		var radiusErr *common.InvalidRadiusError
+		assert.ErrorIs(t, err, common.ErrInvalidRadius, "Expecting %s to reject the radius", name)
+		assert.ErrorAs(t, err, &radiusErr, "Expecting %s to report the radius", name)
+	}
+
+	_, facilitiesErr = tree.BichromaticReverseKNearestNeighbors(query, 1, nil)
+	assert.ErrorIs(t, facilitiesErr, common.ErrNoFacilities, "Expecting an error without facilities")
+	_, aggregateErr := tree.AggregateRegion(testRegions(dimension)["sphere"])
+	assert.ErrorIs(t, aggregateErr, common.ErrNoAggregate, "Expecting an error without an aggregate")
+	duplicated := common.IndexPoints([][]float64{{1, 2, 3}, {4, 5, 6}})
+	duplicated[1].(*common.IndexedPoint).Index = 0
+	var duplicateErr *common.DuplicateIDError
+	assert.ErrorAs(t, tree.Construct(duplicated, dimension), &duplicateErr, "Expecting an error for a shared ID")
+	assert.ErrorIs(t, tree.Construct(duplicated, dimension), common.ErrDuplicateID, "Expecting an error for a shared ID")
+
+	zero := createPoints(3, 0, -100, 100)
+	for name, err := range map[string]error{
+		"Construct": tree.Construct(zero, 0),
+		"Insert":    (&balltree.BallTree{}).Insert(zero[0]),
+	} {
+		var dimensionErr *common.InvalidDimensionError
+		assert.ErrorIs(t, err, common.ErrInvalidDimension, "Expecting %s to reject a zero dimension", name)
+		assert.ErrorAs(t, err, &dimensionErr, "Expecting %s to report the dimension", name)
+	}
+	assert.Nil(t, tree.Construct([]common.Point{}, dimension), "No error should be returned")
+	treeSizeValidator(t, 0, &tree)
+	assert.Nil(t, tree.Left, "Expecting construction to clear the old tree")
+}
+
+func TestConstructionIsReproducible(t *testing.T) {
+	nPoints := 2000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	// Ties make the partitions depend on the pivots chosen
+	for _, p := range points[:nPoints/2] {
+		p.Vector()[0] = math.Round(p.Vector()[0] / 25)
+	}
+	build := func(options ...common.ConstructOption) []byte {
+		tree := balltree.BallTree{}
+		assert.Nil(t, tree.Construct(append([]common.Point{}, points...), dimension, options...), "No error should be returned")
+		result, err := json.Marshal(tree)
+		assert.Nil(t, err, "No error should be returned")
+		return result
+	}
+	seeded := build(common.WithSeed(11))
+	assert.Equal(t, seeded, build(common.WithSeed(11)), "Expecting two builds with the same seed to be identical")
+	option := common.WithSeed(11)
+	assert.Equal(t, build(option), build(option), "Expecting a reused seed option to give identical builds")
+	assert.Equal(t, seeded, build(common.WithRandom(rand.New(rand.NewSource(11)))), "Expecting a source with the same seed to give the same build")
+}
+
+func TestCanReportStats(t *testing.T) {
+	nPoints := 1000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	tree := balltree.BallTree{}
+	assert.Nil(t, tree.Construct(points, dimension), "No error should be returned")
+	stats := tree.Stats()
+	assert.Equal(t, nPoints, stats.Nodes, "Expecting a node for every point")
+	assert.Equal(t, tree.Depth(), stats.MaxDepth, "Expecting the maximum depth to be the depth of the tree")
+	assert.Len(t, stats.NodesPerLevel, stats.MaxDepth, "Expecting a count for every level")
+	nodes, leaves := 0, 0
+	for i := range stats.NodesPerLevel {
+		nodes += stats.NodesPerLevel[i]
+		leaves += stats.LeafDepths[i]
+	}
+	assert.Equal(t, stats.Nodes, nodes, "Expecting the levels to hold every node")
+	assert.Equal(t, stats.Leaves, leaves, "Expecting the leaf depths to hold every leaf")
+	assert.Equal(t, nPoints, stats.Radii.Count, "Expecting a radius for every ball")
+	assert.LessOrEqual(t, stats.Radii.P10, stats.Radii.Median, "Expecting the percentiles to be ordered")
+	assert.LessOrEqual(t, stats.Radii.Median, stats.Radii.P90, "Expecting the percentiles to be ordered")
+	assert.Equal(t, stats.SiblingOverlap.Count, stats.SiblingOverlapVolume.Count, "Expecting a volume for every pair of siblings")
+	assert.Greater(t, stats.SiblingOverlap.Count, 0, "Expecting pairs of siblings")
+	assert.GreaterOrEqual(t, stats.SiblingOverlap.Min, 0.0, "Expecting overlaps to be fractions")
+	assert.LessOrEqual(t, stats.SiblingOverlap.Max, 1.0, "Expecting overlaps to be fractions")
+	assert.Equal(t, stats, tree.Stats(), "Expecting the same tree to give the same report")
+
+	// Two clusters far apart give the root disjoint children
+	separated := createPoints(100, dimension, 0, 1)
+	for _, p := range separated[50:] {
+		for i := range p.Vector() {
+			p.Vector()[i] += 100
+		}
+	}
+	assert.Nil(t, tree.Construct(separated, dimension), "No error should be returned")
+	left, right := tree.Left.Root, tree.Right.Root
+	d, _ := common.Distance(left.Centroid, right.Centroid)
+	assert.Greater(t, d, left.Radius+right.Radius, "Expecting the children of the root to be disjoint")
+	assert.Equal(t, 0.0, tree.Stats().SiblingOverlap.Min, "Expecting disjoint siblings not to overlap")
+
+	empty := balltree.BallTree{}
+	assert.Nil(t, empty.Construct([]common.Point{}, dimension), "No error should be returned")
+	stats = empty.Stats()
+	assert.Equal(t, 0, stats.Nodes, "Expecting an empty tree to have no nodes")
+	assert.Equal(t, 0, stats.Radii.Count, "Expecting an empty tree to have no radii")
+}
+
+func TestCanExportDOT(t *testing.T) {
+	tree := balltree.BallTree{}
+	assert.Nil(t, tree.ConstructIndexed([][]float64{{0, 0}, {2, 0}}, common.WithSeed(1)), "No error should be returned")
+	result, err := tree.DOT(common.DOTOptions{IncludePoints: true})
+	assert.Nil(t, err, "No error should be returned")
+	expected := `digraph BallTree {
+	node [shape=box];
+	n0 [label="centroid (1, 0)\nradius 1\nid 1\npoint (2, 0)"];
+	n0 -> n1 [label="left"];
+	n1 [label="centroid (0, 0)\nradius 0\nid 0\npoint (0, 0)"];
+}
+`
+	assert.Equal(t, expected, result, "Expecting the tree to be drawn with its points")
+
+	nPoints := 200
+	points := createPoints(nPoints, 3, -100, 100)
+	assert.Nil(t, tree.Construct(points, 3, common.WithSeed(5)), "No error should be returned")
+	result, _ = tree.DOT(common.DOTOptions{})
+	again, _ := tree.DOT(common.DOTOptions{})
+	assert.Equal(t, result, again, "Expecting the same tree to be drawn the same way")
+	assert.Equal(t, nPoints-1, strings.Count(result, " -> "), "Expecting an edge to every node but the root")
+	assert.NotContains(t, result, "point (", "Expecting points to be left out by default")
+	truncated, _ := tree.DOT(common.DOTOptions{MaxDepth: 3})
+	assert.Equal(t, 14, strings.Count(truncated, " -> "), "Expecting edges only down to the summaries")
+	assert.Equal(t, 8, strings.Count(truncated, "style=dashed"), "Expecting a summary for every truncated subtree")
+
+	_, err = tree.DOT(common.DOTOptions{MaxDepth: -1})
+	assert.NotNil(t, err, "Expecting a negative depth to be rejected")
+	empty := balltree.BallTree{}
+	result, err = empty.DOT(common.DOTOptions{})
+	assert.Nil(t, err, "No error should be returned")
+	assert.Equal(t, "digraph BallTree {\n\tnode [shape=box];\n}\n", result, "Expecting an empty tree to have no nodes")
+}
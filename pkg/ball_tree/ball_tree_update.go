@@ -0,0 +1,139 @@
+package balltree
+
+import (
+	"math"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Adds a point as a new leaf, descending towards the nearer ball at each node and growing the
+// balls along the way to hold it. Sizes and aggregates are kept up to date. An empty tree with
+// no dimension takes that of the point. The tree is not rebalanced, so many insertions may
+// leave it deeper, and its balls looser, than a freshly constructed one.
+func (tree *BallTree) Insert(point common.Point) error {
+	if err := common.CheckPositiveDimension("point", point.Dimension()); err != nil {
+		return err
+	}
+	if tree.Root == nil && tree.Dimension == 0 {
+		tree.Dimension = point.Dimension()
+	}
+	if err := common.CheckDimension("point", point.Dimension(), tree.Dimension); err != nil {
+		return err
+	}
+	if err := tree.ids.Track(point, tree.Points); err != nil {
+		return err
+	}
+	tree.insert(point)
+	return nil
+}
+
+func (tree *BallTree) insert(point common.Point) {
+	vector := point.Vector()
+	if tree.Root == nil {
+		tree.Root = &BallTreeNode{Centroid: append(common.PointVector{}, vector...), Data: point}
+		tree.refresh()
+		return
+	}
+	d, _ := common.Distance(vector, tree.Root.Centroid)
+	tree.Root.Radius = math.Max(tree.Root.Radius, d)
+	switch {
+	case tree.Left == nil:
+		tree.Left = &BallTree{Dimension: tree.Dimension, aggregate: tree.aggregate}
+		tree.Left.insert(point)
+	case tree.Right == nil:
+		tree.Right = &BallTree{Dimension: tree.Dimension, aggregate: tree.aggregate}
+		tree.Right.insert(point)
+	default:
+		left, _ := common.Distance(vector, tree.Left.Root.Centroid)
+		right, _ := common.Distance(vector, tree.Right.Root.Centroid)
+		if left <= right {
+			tree.Left.insert(point)
+		} else {
+			tree.Right.insert(point)
+		}
+	}
+	tree.refresh()
+}
+
+// Removes a point from the tree, returning whether it was found. Points are matched as by
+// common.SamePoint, so by ID or else by coordinates. A removed pivot is replaced by a point taken from a leaf below it.
+// Balls are not shrunk, so they remain valid but may be looser than needed.
+func (tree *BallTree) Delete(point common.Point) (bool, error) {
+	if err := common.CheckDimension("point", point.Dimension(), tree.Dimension); err != nil {
+		return false, err
+	}
+	vector := point.Vector()
+	if identified, ok := point.(common.IdentifiedPoint); ok {
+		// Descend to the stored point, as the coordinates given for it may be stale
+		stored, found := tree.ids.Lookup(identified.ID(), tree.Points)
+		if !found {
+			return false, nil
+		}
+		vector = stored.Vector()
+	}
+	removed := tree.delete(point, vector)
+	if removed == nil {
+		return false, nil
+	}
+	tree.ids.Untrack(removed)
+	return true, nil
+}
+
+// Removes the point, found by descending towards the vector, returning the point of the tree
+// which stood for it
+func (tree *BallTree) delete(point common.Point, vector common.PointVector) common.Point {
+	if tree.Root == nil {
+		return nil
+	}
+	if !common.SamePoint(point, tree.Root.Data) {
+		var removed common.Point
+		for _, child := range []*BallTree{tree.Left, tree.Right} {
+			if removed == nil && child != nil && child.Root.SearchChildren(vector, 0) {
+				removed = child.delete(point, vector)
+			}
+		}
+		if removed != nil {
+			tree.prune()
+			tree.refresh()
+		}
+		return removed
+	}
+	removed := tree.Root.Data
+	if tree.Left == nil && tree.Right == nil {
+		tree.Root = nil
+		return removed
+	}
+	replacement := tree.takeLeaf()
+	tree.Root = &BallTreeNode{Centroid: tree.Root.Centroid, Data: replacement, Radius: tree.Root.Radius}
+	tree.prune()
+	tree.refresh()
+	return removed
+}
+
+// Removes a leaf below the root, returning its point
+func (tree *BallTree) takeLeaf() common.Point {
+	child := tree.Left
+	if child == nil {
+		child = tree.Right
+	}
+	var result common.Point
+	if child.Left == nil && child.Right == nil {
+		result = child.Root.Data
+		child.Root = nil
+	} else {
+		result = child.takeLeaf()
+	}
+	tree.prune()
+	tree.refresh()
+	return result
+}
+
+// Drops children left empty by a deletion
+func (tree *BallTree) prune() {
+	if tree.Left != nil && tree.Left.Root == nil {
+		tree.Left = nil
+	}
+	if tree.Right != nil && tree.Right.Root == nil {
+		tree.Right = nil
+	}
+}
@@ -0,0 +1,517 @@
+package clustering_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	balltree "github.com/KrishanBhalla/space-partitioning-trees/pkg/ball_tree"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/clustering"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	kdtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/kd_tree"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPoint struct {
+	dimension int
+	vector    common.PointVector
+}
+
+func (t *testPoint) Dimension() int {
+	return t.dimension
+}
+
+func (t *testPoint) Vector() common.PointVector {
+	return t.vector
+}
+
+func createPoint(dimension int, lowerBound, upperBound float64) common.Point {
+	vector := make([]float64, dimension)
+	for i := range vector {
+		vector[i] = lowerBound + rand.Float64()*(upperBound-lowerBound)
+	}
+	return &testPoint{dimension: dimension, vector: vector}
+}
+
+// Gaussian blobs about random centres, with uniform background noise
+func createBlobs(nBlobs, pointsPerBlob, nNoise, dimension int, spread float64) []common.Point {
+	result := []common.Point{}
+	for b := 0; b < nBlobs; b++ {
+		centre := createPoint(dimension, 0, 10).Vector()
+		for i := 0; i < pointsPerBlob; i++ {
+			vector := make(common.PointVector, dimension)
+			for j := range vector {
+				vector[j] = centre[j] + rand.NormFloat64()*spread
+			}
+			result = append(result, &testPoint{dimension: dimension, vector: vector})
+		}
+	}
+	for i := 0; i < nNoise; i++ {
+		result = append(result, createPoint(dimension, 0, 10))
+	}
+	rand.Shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	return result
+}
+
+func createTrees(points []common.Point, dimension int) map[string]common.SpacePartitioningTree {
+	kd := kdtree.KdTree{}
+	kd.Construct(points, dimension)
+	ball := balltree.BallTree{}
+	ball.Construct(points, dimension)
+	return map[string]common.SpacePartitioningTree{"kd": &kd, "ball": &ball}
+}
+
+func bruteForceDBSCAN(points []common.Point, eps float64, minPoints int) ([]int, []bool) {
+	neighbourhoods := make([][]int, len(points))
+	for i, p := range points {
+		for j, q := range points {
+			if d, _ := common.Distance(p.Vector(), q.Vector()); d < eps {
+				neighbourhoods[i] = append(neighbourhoods[i], j)
+			}
+		}
+	}
+	labels := make([]int, len(points))
+	core := make([]bool, len(points))
+	for i := range points {
+		labels[i] = clustering.Noise
+		core[i] = len(neighbourhoods[i]) >= minPoints
+	}
+	clusters := 0
+	for i := range points {
+		if !core[i] || labels[i] != clustering.Noise {
+			continue
+		}
+		labels[i] = clusters
+		queue := []int{i}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, j := range neighbourhoods[current] {
+				if labels[j] == clustering.Noise {
+					labels[j] = clusters
+					if core[j] {
+						queue = append(queue, j)
+					}
+				}
+			}
+		}
+		clusters++
+	}
+	return labels, core
+}
+
+func TestDBSCAN(t *testing.T) {
+	dimension := 2
+	points := createBlobs(5, 300, 200, dimension, 0.3)
+	expectedLabels, expectedCore := bruteForceDBSCAN(points, 0.3, 8)
+	for name, tree := range createTrees(points, dimension) {
+		for _, workers := range []int{1, 4} {
+			result, err := clustering.DBSCAN{Eps: 0.3, MinPoints: 8, Workers: workers}.Fit(tree, points)
+			assert.Nil(t, err)
+			assert.Equal(t, expectedLabels, result.Labels, name)
+			assert.Equal(t, expectedCore, result.Core, name)
+			assert.Greater(t, result.Clusters, 0)
+			assert.Contains(t, result.Labels, clustering.Noise)
+		}
+	}
+}
+
+func TestDBSCANErrors(t *testing.T) {
+	points := createBlobs(1, 10, 0, 2, 1)
+	tree := createTrees(points, 2)["kd"]
+	_, err := clustering.DBSCAN{Eps: 0, MinPoints: 3}.Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = clustering.DBSCAN{Eps: 1, MinPoints: 0}.Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = clustering.DBSCAN{Eps: 1, MinPoints: 3}.Fit(tree, []common.Point{createPoint(3, 0, 1)})
+	assert.NotNil(t, err)
+
+	result, err := clustering.DBSCAN{Eps: 1, MinPoints: 3}.Fit(tree, []common.Point{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Clusters)
+	assert.Empty(t, result.Labels)
+}
+
+func TestDBSCANAcceptsPlainPoints(t *testing.T) {
+	blobs := createBlobs(3, 100, 20, 2, 0.3)
+	points := make([]common.Point, 0, len(blobs)+50)
+	for _, p := range blobs {
+		points = append(points, anonymousPoint{p.Vector()})
+	}
+	// Coincident points are found, and labelled, together
+	for _, p := range blobs[:50] {
+		points = append(points, anonymousPoint{append(common.PointVector{}, p.Vector()...)})
+	}
+	expectedLabels, expectedCore := bruteForceDBSCAN(points, 0.3, 5)
+	for name, tree := range map[string]common.SpacePartitioningTree{"kd": &kdtree.KdTree{}, "ball": &balltree.BallTree{}} {
+		assert.Nil(t, tree.Construct(points, 2))
+		result, err := clustering.DBSCAN{Eps: 0.3, MinPoints: 5}.Fit(tree, points)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expectedLabels, result.Labels, name)
+		assert.Equal(t, expectedCore, result.Core, name)
+	}
+}
+
+type anonymousPoint struct {
+	vector common.PointVector
+}
+
+func (a anonymousPoint) Dimension() int {
+	return len(a.vector)
+}
+
+func (a anonymousPoint) Vector() common.PointVector {
+	return a.vector
+}
+
+func TestHDBSCANFindsClustersOfVaryingDensity(t *testing.T) {
+	dimension := 2
+	centres := []common.PointVector{{0, 0}, {10, 0}, {0, 10}}
+	spreads := []float64{0.1, 0.4, 1}
+	blob := map[common.Point]int{}
+	points := []common.Point{}
+	for b, centre := range centres {
+		for i := 0; i < 300; i++ {
+			vector := common.PointVector{centre[0] + rand.NormFloat64()*spreads[b], centre[1] + rand.NormFloat64()*spreads[b]}
+			p := &testPoint{dimension: dimension, vector: vector}
+			blob[p] = b
+			points = append(points, p)
+		}
+	}
+	for i := 0; i < 30; i++ {
+		p := createPoint(dimension, -5, 15)
+		blob[p] = clustering.Noise
+		points = append(points, p)
+	}
+	rand.Shuffle(len(points), func(i, j int) { points[i], points[j] = points[j], points[i] })
+
+	for name, tree := range createTrees(points, dimension) {
+		result, err := clustering.HDBSCAN{MinClusterSize: 20, MinSamples: 10}.Fit(tree.(clustering.Tree), points)
+		assert.Nil(t, err)
+		assert.Len(t, result.SelectedClusters, 3, name)
+
+		// Each cluster should be made almost entirely of the points of one blob
+		counts := map[[2]int]int{}
+		for i, p := range points {
+			counts[[2]int{result.Labels[i], blob[p]}]++
+			assert.GreaterOrEqual(t, result.Probabilities[i], 0.)
+			assert.LessOrEqual(t, result.Probabilities[i], 1.)
+			assert.GreaterOrEqual(t, result.OutlierScores[i], 0.)
+			assert.LessOrEqual(t, result.OutlierScores[i], 1.)
+			if result.Labels[i] == clustering.Noise {
+				assert.Equal(t, 0., result.Probabilities[i])
+			}
+		}
+		for label := range result.SelectedClusters {
+			best := 0
+			for b := range centres {
+				best = max(best, counts[[2]int{label, b}])
+			}
+			assert.Greater(t, best, 270, name)
+		}
+
+		// Background points should look more like outliers than the points of the densest blob
+		noiseScore, blobScore := 0., 0.
+		for i, p := range points {
+			switch blob[p] {
+			case clustering.Noise:
+				noiseScore += result.OutlierScores[i] / 30
+			case 0:
+				blobScore += result.OutlierScores[i] / 300
+			}
+		}
+		assert.Greater(t, noiseScore, blobScore, name)
+
+		// Every point leaves the condensed tree exactly once
+		seen := map[int]int{}
+		for _, e := range result.CondensedTree {
+			if e.Child < len(points) {
+				seen[e.Child]++
+				assert.Equal(t, 1, e.Size)
+			}
+		}
+		assert.Len(t, seen, len(points))
+	}
+}
+
+func TestHDBSCANAcceptsPlainPoints(t *testing.T) {
+	blobs := createBlobs(3, 100, 20, 2, 0.3)
+	points := make([]common.Point, len(blobs))
+	for i, p := range blobs {
+		points[i] = anonymousPoint{p.Vector()}
+	}
+	// Ties in mutual reachability are broken by the shape of the tree, so compare like with like
+	for name, newTree := range map[string]func() clustering.Tree{
+		"kd":   func() clustering.Tree { return &kdtree.KdTree{} },
+		"ball": func() clustering.Tree { return &balltree.BallTree{} },
+	} {
+		byPointer, byValue := newTree(), newTree()
+		assert.Nil(t, byPointer.Construct(blobs, 2, common.WithSeed(1)))
+		assert.Nil(t, byValue.Construct(points, 2, common.WithSeed(1)))
+		expected, err := clustering.HDBSCAN{MinClusterSize: 10}.Fit(byPointer, blobs)
+		assert.Nil(t, err, name)
+		result, err := clustering.HDBSCAN{MinClusterSize: 10}.Fit(byValue, points)
+		assert.Nil(t, err, name)
+		assert.Equal(t, expected.Labels, result.Labels, name)
+		assert.InDeltaSlice(t, expected.OutlierScores, result.OutlierScores, 1e-12, name)
+	}
+}
+
+func TestHDBSCANSeparatesSmallGroups(t *testing.T) {
+	vectors := []common.PointVector{{0}, {0.1}, {0.2}, {0.3}, {10}, {10.1}, {10.2}, {10.3}, {50}}
+	points := make([]common.Point, len(vectors))
+	for i, v := range vectors {
+		points[i] = &testPoint{dimension: 1, vector: v}
+	}
+	for name, tree := range createTrees(points, 1) {
+		result, err := clustering.HDBSCAN{MinClusterSize: 3, MinSamples: 2}.Fit(tree.(clustering.Tree), points)
+		assert.Nil(t, err)
+		assert.Equal(t, []int{0, 0, 0, 0, 1, 1, 1, 1, clustering.Noise}, result.Labels, name)
+		assert.Greater(t, result.OutlierScores[8], result.OutlierScores[0], name)
+	}
+}
+
+func TestHDBSCANHandlesDuplicatePoints(t *testing.T) {
+	dimension := 2
+	points := createBlobs(2, 100, 0, dimension, 0.3)
+	for i := 0; i < 30; i++ {
+		points = append(points, &testPoint{dimension: dimension, vector: common.PointVector{20, 20}})
+	}
+	for _, minSamples := range []int{1, 5} {
+		for name, tree := range createTrees(points, dimension) {
+			result, err := clustering.HDBSCAN{MinClusterSize: 10, MinSamples: minSamples}.Fit(tree.(clustering.Tree), points)
+			assert.Nil(t, err, name)
+			for _, e := range result.CondensedTree {
+				assert.False(t, math.IsInf(e.Lambda, 0) || math.IsNaN(e.Lambda), "Expecting finite lambdas, found %v", e.Lambda)
+			}
+			for i := range points {
+				assert.False(t, math.IsNaN(result.Probabilities[i]), "Expecting probabilities to be numbers")
+				assert.False(t, math.IsNaN(result.OutlierScores[i]), "Expecting outlier scores to be numbers")
+			}
+			duplicates := result.Labels[len(points)-30:]
+			assert.NotEqual(t, clustering.Noise, duplicates[0], name)
+			for _, label := range duplicates {
+				assert.Equal(t, duplicates[0], label, "Expecting the duplicates to form one cluster")
+			}
+		}
+	}
+}
+
+func TestHDBSCANErrors(t *testing.T) {
+	points := createBlobs(1, 10, 0, 2, 1)
+	tree := createTrees(points, 2)["ball"].(clustering.Tree)
+	_, err := clustering.HDBSCAN{MinClusterSize: 1}.Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = clustering.HDBSCAN{MinClusterSize: 3, MinSamples: -1}.Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = clustering.HDBSCAN{MinClusterSize: 3}.Fit(tree, points[:5])
+	assert.NotNil(t, err)
+
+	result, err := clustering.HDBSCAN{MinClusterSize: 20}.Fit(tree, points)
+	assert.Nil(t, err)
+	assert.Empty(t, result.SelectedClusters)
+	for _, label := range result.Labels {
+		assert.Equal(t, clustering.Noise, label)
+	}
+}
+
+func TestKMeansConvergesToLloydFixedPoint(t *testing.T) {
+	dimension := 3
+	points := createBlobs(6, 300, 200, dimension, 0.8)
+	tree := createTrees(points, dimension)["kd"].(*kdtree.KdTree)
+	result, err := clustering.KMeans{K: 5, Seed: 7}.Fit(tree, points)
+	assert.Nil(t, err)
+	assert.Len(t, result.Centres, 5)
+
+	sums := make([]common.PointVector, 5)
+	counts := make([]int, 5)
+	inertia := 0.
+	for i, p := range points {
+		// Every point should be labelled with its nearest centre
+		best, bestDistance := -1, math.Inf(1)
+		for c, centre := range result.Centres {
+			if d, _ := common.Distance(p.Vector(), centre); d < bestDistance {
+				best, bestDistance = c, d
+			}
+		}
+		assert.Equal(t, best, result.Labels[i])
+		inertia += bestDistance * bestDistance
+		if sums[best] == nil {
+			sums[best] = make(common.PointVector, dimension)
+		}
+		for j, v := range p.Vector() {
+			sums[best][j] += v
+		}
+		counts[best]++
+	}
+	assert.InEpsilon(t, inertia, result.Inertia, 1e-9)
+	// and every centre should be the mean of its points
+	for c, centre := range result.Centres {
+		for j := range centre {
+			assert.InDelta(t, sums[c][j]/float64(counts[c]), centre[j], 1e-9)
+		}
+	}
+
+	again, err := clustering.KMeans{K: 5, Seed: 7}.Fit(tree, points)
+	assert.Nil(t, err)
+	assert.Equal(t, result, again, "Expecting a fixed seed to give the same result")
+}
+
+func TestKMeansFindsSeparatedBlobs(t *testing.T) {
+	dimension := 2
+	centres := []common.PointVector{{0, 0}, {20, 0}, {0, 20}, {20, 20}}
+	points := []common.Point{}
+	for _, centre := range centres {
+		for i := 0; i < 200; i++ {
+			points = append(points, &testPoint{dimension: dimension, vector: common.PointVector{centre[0] + rand.NormFloat64(), centre[1] + rand.NormFloat64()}})
+		}
+	}
+	tree := createTrees(points, dimension)["kd"].(*kdtree.KdTree)
+	result, err := clustering.KMeans{K: 4, Tolerance: 1e-6, Seed: 1}.Fit(tree, points)
+	assert.Nil(t, err)
+	for _, expected := range centres {
+		nearest := math.Inf(1)
+		for _, centre := range result.Centres {
+			d, _ := common.Distance(expected, centre)
+			nearest = math.Min(nearest, d)
+		}
+		assert.Less(t, nearest, 0.5)
+	}
+	for i := range points {
+		assert.Equal(t, result.Labels[i/200*200], result.Labels[i])
+	}
+}
+
+func TestKMeansAcceptsPlainPoints(t *testing.T) {
+	blobs := createBlobs(3, 100, 20, 2, 0.3)
+	points := make([]common.Point, 0, len(blobs)+50)
+	for _, p := range blobs {
+		points = append(points, anonymousPoint{p.Vector()})
+	}
+	// Coincident points are each labelled
+	for _, p := range blobs[:50] {
+		points = append(points, anonymousPoint{append(common.PointVector{}, p.Vector()...)})
+	}
+	kd := kdtree.KdTree{}
+	assert.Nil(t, kd.Construct(points, 2))
+	result, err := clustering.KMeans{K: 3, Seed: 1}.Fit(&kd, points)
+	assert.Nil(t, err)
+	for i, p := range points {
+		best, bestDistance := -1, math.Inf(1)
+		for c, centre := range result.Centres {
+			if d, _ := common.Distance(p.Vector(), centre); d < bestDistance {
+				best, bestDistance = c, d
+			}
+		}
+		assert.Equal(t, best, result.Labels[i])
+	}
+
+	// Points which are not in the tree cannot be matched to it
+	other := append(append([]common.Point{}, points[1:]...), anonymousPoint{common.PointVector{100, 100}})
+	_, err = clustering.KMeans{K: 3}.Fit(&kd, other)
+	assert.NotNil(t, err)
+}
+
+func TestKMeansErrors(t *testing.T) {
+	points := createBlobs(1, 10, 0, 2, 1)
+	tree := createTrees(points, 2)["kd"].(*kdtree.KdTree)
+	_, err := clustering.KMeans{K: 0}.Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = clustering.KMeans{K: 11}.Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = clustering.KMeans{K: 2, Tolerance: -1}.Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = clustering.KMeans{K: 2}.Fit(tree, points[:5])
+	assert.NotNil(t, err)
+	_, err = clustering.KMeans{K: 1}.Fit(tree, []common.Point{createPoint(3, 0, 1)})
+	assert.NotNil(t, err)
+}
+
+type weightedTestPoint struct {
+	testPoint
+	weight float64
+}
+
+func (t *weightedTestPoint) Weight() float64 {
+	return t.weight
+}
+
+func TestKMeansWeightsPoints(t *testing.T) {
+	dimension := 2
+	points := createBlobs(4, 200, 50, dimension, 1)
+	for i, p := range points {
+		points[i] = &weightedTestPoint{testPoint: *p.(*testPoint), weight: rand.Float64() * 4}
+	}
+	tree := createTrees(points, dimension)["kd"].(*kdtree.KdTree)
+	result, err := clustering.KMeans{K: 4, Seed: 3}.Fit(tree, points)
+	assert.Nil(t, err)
+
+	sums := make([]common.PointVector, 4)
+	weights := make([]float64, 4)
+	inertia := 0.
+	for i, p := range points {
+		c := result.Labels[i]
+		w := common.Weight(p)
+		d, _ := common.Distance(p.Vector(), result.Centres[c])
+		inertia += w * d * d
+		if sums[c] == nil {
+			sums[c] = make(common.PointVector, dimension)
+		}
+		for j, v := range p.Vector() {
+			sums[c][j] += w * v
+		}
+		weights[c] += w
+	}
+	assert.InEpsilon(t, inertia, result.Inertia, 1e-9)
+	// Every centre should be the weighted mean of its points
+	for c, centre := range result.Centres {
+		for j := range centre {
+			assert.InDelta(t, sums[c][j]/weights[c], centre[j], 1e-9)
+		}
+	}
+
+	// A single cluster sits at the weighted mean of everything
+	single, err := clustering.KMeans{K: 1}.Fit(tree, points)
+	assert.Nil(t, err)
+	mean := make(common.PointVector, dimension)
+	total := 0.
+	for _, p := range points {
+		for j, v := range p.Vector() {
+			mean[j] += common.Weight(p) * v
+		}
+		total += common.Weight(p)
+	}
+	for j := range mean {
+		assert.InDelta(t, mean[j]/total, single.Centres[0][j], 1e-9)
+	}
+}
+
+func TestKMeansBreaksTiesByLowestCentre(t *testing.T) {
+	// The centres settle on the two weighted points, so that the weightless points on the line
+	// between them are equidistant from both
+	points := []common.Point{
+		&weightedTestPoint{testPoint: testPoint{dimension: 2, vector: common.PointVector{-1, 0}}, weight: 1},
+		&weightedTestPoint{testPoint: testPoint{dimension: 2, vector: common.PointVector{1, 0}}, weight: 1},
+	}
+	for i := 0; i < 200; i++ {
+		x := 0.
+		if i%2 == 1 {
+			x = rand.Float64()*2 - 1
+		}
+		points = append(points, &weightedTestPoint{testPoint: testPoint{dimension: 2, vector: common.PointVector{x, rand.Float64()*4 - 2}}})
+	}
+	tree := createTrees(points, 2)["kd"].(*kdtree.KdTree)
+	for seed := int64(0); seed < 10; seed++ {
+		result, err := clustering.KMeans{K: 2, Seed: seed}.Fit(tree, points)
+		assert.Nil(t, err)
+		for i, p := range points {
+			best, bestDistance := -1, math.Inf(1)
+			for c, centre := range result.Centres {
+				if d, _ := common.Distance(p.Vector(), centre); d < bestDistance {
+					best, bestDistance = c, d
+				}
+			}
+			assert.Equal(t, best, result.Labels[i], "Expecting ties to go to the lowest numbered centre")
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package clustering
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// The label of points which belong to no cluster
+const Noise = -1
+
+// DBSCAN groups points which are densely packed together. A core point has at least MinPoints
+// points, itself included, strictly within Eps of it. Clusters are the sets of core points
+// reachable from one another through core neighbourhoods, together with the points in those
+// neighbourhoods.
+type DBSCAN struct {
+	Eps       float64
+	MinPoints int
+	// Defaults to GOMAXPROCS
+	Workers int
+}
+
+type DBSCANResult struct {
+	// The cluster of each input point, numbered from zero, or Noise
+	Labels []int
+	Core   []bool
+	// The number of clusters found
+	Clusters int
+}
+
+// Clusters the points, which must be exactly the points the tree was constructed from. Points
+// are matched to search results by their coordinates, so points which coincide are found, and
+// labelled, together. Neighbourhoods are searched in parallel, but clusters are numbered and
+// border points assigned in input order, so the result depends only on the order of the points.
+func (dbscan DBSCAN) Fit(tree common.SpacePartitioningTree, points []common.Point) (*DBSCANResult, error) {
+	if !(dbscan.Eps > 0) {
+		return nil, fmt.Errorf("Eps must be positive, found %v", dbscan.Eps)
+	}
+	if dbscan.MinPoints <= 0 {
+		return nil, fmt.Errorf("MinPoints must be positive, found %d", dbscan.MinPoints)
+	}
+	for _, p := range points {
+		if err := common.CheckDimension("query point", p.Dimension(), tree.NodeDimension()); err != nil {
+			return nil, err
+		}
+	}
+	neighbourhoods, err := dbscan.coreNeighbourhoods(tree, points, common.NewCoordinateIndex(points))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DBSCANResult{Labels: make([]int, len(points)), Core: make([]bool, len(points))}
+	for i := range points {
+		result.Labels[i] = Noise
+		result.Core[i] = neighbourhoods[i] != nil
+	}
+	for i := range points {
+		if !result.Core[i] || result.Labels[i] != Noise {
+			continue
+		}
+		cluster := result.Clusters
+		result.Clusters++
+		result.Labels[i] = cluster
+		queue := []int{i}
+		for len(queue) > 0 {
+			current := queue[0]
+			queue = queue[1:]
+			for _, j := range neighbourhoods[current] {
+				if result.Labels[j] != Noise {
+					continue
+				}
+				result.Labels[j] = cluster
+				if result.Core[j] {
+					queue = append(queue, j)
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// Returns the sorted neighbour indices of each core point, and nil for every other point
+func (dbscan DBSCAN) coreNeighbourhoods(tree common.SpacePartitioningTree, points []common.Point, index common.CoordinateIndex) ([][]int, error) {
+	workers := dbscan.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	neighbourhoods := make([][]int, len(points))
+	errs := make([]error, len(points))
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				neighbours, err := tree.Search(points[i], dbscan.Eps)
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				if len(neighbours) < dbscan.MinPoints {
+					continue
+				}
+				neighbourhood := make([]int, 0, len(neighbours))
+				// Every point of a group of coincident points is found, so the group is added once
+				added := map[int]bool{}
+				for _, n := range neighbours {
+					if group := index.Of(n); len(group) > 0 && !added[group[0]] {
+						added[group[0]] = true
+						neighbourhood = append(neighbourhood, group...)
+					}
+				}
+				sort.Ints(neighbourhood)
+				neighbourhoods[i] = neighbourhood
+			}
+		}()
+	}
+	for i := range points {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return neighbourhoods, nil
+}
@@ -0,0 +1,353 @@
+package clustering
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	dualtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/dual_tree"
+)
+
+// Tree is a space partitioning tree which also exposes its nodes, as KdTree and BallTree do
+type Tree interface {
+	common.SpacePartitioningTree
+	common.Subtree
+}
+
+// HDBSCAN clusters points of varying density by building the hierarchy of DBSCAN clusterings
+// over every radius, condensing it to the clusters holding at least MinClusterSize points, and
+// keeping the most stable of those (HDBSCAN* with excess of mass selection).
+type HDBSCAN struct {
+	// At least two
+	MinClusterSize int
+	// The core distance of a point is the distance to its MinSamples-th nearest neighbour,
+	// counting itself. Defaults to MinClusterSize.
+	MinSamples int
+	// Defaults to GOMAXPROCS
+	Workers int
+}
+
+// CondensedTreeEdge records a child leaving a cluster of the condensed tree. Nodes below the
+// number of points are points, numbered by input index, and the others are clusters, the root
+// being numbered by the number of points.
+type CondensedTreeEdge struct {
+	Parent int
+	Child  int
+	// The inverse of the mutual reachability distance at which the child leaves the parent
+	Lambda float64
+	// The number of points in the child
+	Size int
+}
+
+type HDBSCANResult struct {
+	// The cluster of each input point, numbered from zero, or Noise
+	Labels []int
+	// How strongly each point belongs to its cluster, from zero for noise to one at its heart
+	Probabilities []float64
+	// The GLOSH outlier score of each point, from zero for inliers towards one for outliers
+	OutlierScores []float64
+	CondensedTree []CondensedTreeEdge
+	// The condensed tree cluster chosen for each label
+	SelectedClusters []int
+}
+
+// Clusters the points, which must be exactly the points the tree was constructed from. As with
+// DBSCAN, points are matched to the tree by their coordinates. Core distances come from k-nearest
+// neighbour queries on the tree, run in parallel, and the mutual reachability spanning tree from
+// a dual-tree Boruvka step.
+func (hdbscan HDBSCAN) Fit(tree Tree, points []common.Point) (*HDBSCANResult, error) {
+	if hdbscan.MinClusterSize < 2 {
+		return nil, fmt.Errorf("MinClusterSize must be at least 2, found %d", hdbscan.MinClusterSize)
+	}
+	minSamples := hdbscan.MinSamples
+	if minSamples == 0 {
+		minSamples = hdbscan.MinClusterSize
+	}
+	if minSamples < 0 {
+		return nil, fmt.Errorf("MinSamples must be positive, found %d", minSamples)
+	}
+	for _, p := range points {
+		if err := common.CheckDimension("query point", p.Dimension(), tree.NodeDimension()); err != nil {
+			return nil, err
+		}
+	}
+	index := common.NewCoordinateIndex(points)
+
+	// The core distance of a point is that to its MinSamples-th nearest point, itself included
+	core := make([]float64, len(points))
+	k := min(minSamples, len(points))
+	err := parallelFor(len(points), hdbscan.Workers, func(i int) error {
+		neighbours, err := tree.KNearestNeighbors(points[i], k)
+		if err != nil {
+			return err
+		}
+		core[i], err = common.Distance(points[i].Vector(), neighbours[len(neighbours)-1].Vector())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	spanningTree, err := dualtree.MutualReachabilitySpanningTree(tree, func(p common.Point) float64 {
+		if group := index.Of(p); len(group) > 0 {
+			return core[group[0]]
+		}
+		return 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(spanningTree.Points) != len(points) {
+		return nil, fmt.Errorf("The tree holds %d points, but %d points were given", len(spanningTree.Points), len(points))
+	}
+	// Renumber the edges by input index
+	positions, err := index.Match(spanningTree.Points)
+	if err != nil {
+		return nil, err
+	}
+	edges := make([]dualtree.Edge, len(spanningTree.Edges))
+	for i, e := range spanningTree.Edges {
+		edges[i] = dualtree.Edge{A: positions[e.A], B: positions[e.B], Weight: e.Weight}
+	}
+
+	h := &hierarchy{n: len(points), minClusterSize: hdbscan.MinClusterSize}
+	h.singleLinkage(edges)
+	h.condense()
+	return h.extract(), nil
+}
+
+// Calls fn for each of 0 to n - 1 on a pool of workers, returning the first error by index
+func parallelFor(n, workers int, fn func(i int) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	errs := make([]error, n)
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A merge of two nodes of the single linkage dendrogram, numbered after the points
+type merge struct {
+	left     int
+	right    int
+	distance float64
+	size     int
+}
+
+type hierarchy struct {
+	n              int
+	minClusterSize int
+	merges         []merge
+	condensed      []CondensedTreeEdge
+	// The number of clusters in the condensed tree
+	clusters int
+}
+
+func (h *hierarchy) size(node int) int {
+	if node < h.n {
+		return 1
+	}
+	return h.merges[node-h.n].size
+}
+
+// Joins the points along the edges of the spanning tree, lightest first
+func (h *hierarchy) singleLinkage(edges []dualtree.Edge) {
+	parent := make([]int, h.n)
+	label := make([]int, h.n)
+	for i := range parent {
+		parent[i] = i
+		label[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i], i = parent[parent[i]], parent[i]
+		}
+		return i
+	}
+	h.merges = make([]merge, len(edges))
+	for m, e := range edges {
+		a, b := find(e.A), find(e.B)
+		h.merges[m] = merge{left: label[a], right: label[b], distance: e.Weight, size: h.size(label[a]) + h.size(label[b])}
+		parent[b] = a
+		label[a] = h.n + m
+	}
+}
+
+// Walks the dendrogram from the root, so that a cluster only splits when both sides are big
+// enough to be clusters. Otherwise the smaller side's points simply fall out of the cluster.
+func (h *hierarchy) condense() {
+	if len(h.merges) == 0 {
+		return
+	}
+	// Coincident points merge at distance zero, which would make lambda infinite and the
+	// stabilities NaN, so distances are clamped to the smallest positive one
+	floor := math.Inf(1)
+	for _, m := range h.merges {
+		if m.distance > 0 {
+			floor = math.Min(floor, m.distance)
+		}
+	}
+	if math.IsInf(floor, 1) {
+		floor = 1
+	}
+	relabel := map[int]int{h.n + len(h.merges) - 1: h.n}
+	h.clusters = 1
+	queue := []int{h.n + len(h.merges) - 1}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		m := h.merges[node-h.n]
+		parent := relabel[node]
+		lambda := 1 / math.Max(m.distance, floor)
+		leftBig, rightBig := h.size(m.left) >= h.minClusterSize, h.size(m.right) >= h.minClusterSize
+		for _, child := range []int{m.left, m.right} {
+			big := h.size(child) >= h.minClusterSize
+			switch {
+			case big && leftBig && rightBig:
+				relabel[child] = h.n + h.clusters
+				h.condensed = append(h.condensed, CondensedTreeEdge{Parent: parent, Child: h.n + h.clusters, Lambda: lambda, Size: h.size(child)})
+				h.clusters++
+				queue = append(queue, child)
+			case big:
+				relabel[child] = parent
+				queue = append(queue, child)
+			default:
+				h.fallOut(child, parent, lambda)
+			}
+		}
+	}
+}
+
+// Records every point below a dendrogram node leaving the cluster
+func (h *hierarchy) fallOut(node, parent int, lambda float64) {
+	stack := []int{node}
+	for len(stack) > 0 {
+		node, stack = stack[len(stack)-1], stack[:len(stack)-1]
+		if node < h.n {
+			h.condensed = append(h.condensed, CondensedTreeEdge{Parent: parent, Child: node, Lambda: lambda, Size: 1})
+		} else {
+			stack = append(stack, h.merges[node-h.n].right, h.merges[node-h.n].left)
+		}
+	}
+}
+
+// Selects the clusters by excess of mass, then labels and scores the points
+func (h *hierarchy) extract() *HDBSCANResult {
+	result := &HDBSCANResult{
+		Labels:           make([]int, h.n),
+		Probabilities:    make([]float64, h.n),
+		OutlierScores:    make([]float64, h.n),
+		CondensedTree:    h.condensed,
+		SelectedClusters: []int{},
+	}
+	for i := range result.Labels {
+		result.Labels[i] = Noise
+	}
+	if h.clusters == 0 {
+		return result
+	}
+
+	// Indexed by cluster number less the number of points
+	birth := make([]float64, h.clusters)
+	parent := make([]int, h.clusters)
+	children := make([][]int, h.clusters)
+	stability := make([]float64, h.clusters)
+	// The largest lambda at which any point of the cluster leaves it
+	death := make([]float64, h.clusters)
+	pointParent := make([]int, h.n)
+	pointLambda := make([]float64, h.n)
+	parent[0] = -1
+	for _, e := range h.condensed {
+		if e.Child >= h.n {
+			birth[e.Child-h.n] = e.Lambda
+			parent[e.Child-h.n] = e.Parent - h.n
+			children[e.Parent-h.n] = append(children[e.Parent-h.n], e.Child-h.n)
+		} else {
+			pointParent[e.Child] = e.Parent - h.n
+			pointLambda[e.Child] = e.Lambda
+			death[e.Parent-h.n] = math.Max(death[e.Parent-h.n], e.Lambda)
+		}
+	}
+	for _, e := range h.condensed {
+		stability[e.Parent-h.n] += (e.Lambda - birth[e.Parent-h.n]) * float64(e.Size)
+	}
+	// Children are always numbered after their parents
+	for c := h.clusters - 1; c > 0; c-- {
+		death[parent[c]] = math.Max(death[parent[c]], death[c])
+	}
+
+	// The root is never selected, so that a single cluster is not reported for everything
+	selected := make([]bool, h.clusters)
+	for c := h.clusters - 1; c > 0; c-- {
+		childStability := 0.
+		for _, child := range children[c] {
+			childStability += stability[child]
+		}
+		if childStability > stability[c] {
+			stability[c] = childStability
+			continue
+		}
+		selected[c] = true
+		stack := append([]int{}, children[c]...)
+		for len(stack) > 0 {
+			descendant := stack[len(stack)-1]
+			stack = append(stack[:len(stack)-1], children[descendant]...)
+			selected[descendant] = false
+		}
+	}
+
+	// The selected cluster holding each cluster, if any
+	holder := make([]int, h.clusters)
+	holder[0] = -1
+	for c := 1; c < h.clusters; c++ {
+		holder[c] = holder[parent[c]]
+		if selected[c] {
+			holder[c] = c
+		}
+	}
+	// Number the clusters in order of their first point, as DBSCAN does
+	label := map[int]int{-1: Noise}
+	for i := range result.Labels {
+		c := holder[pointParent[i]]
+		if _, ok := label[c]; !ok {
+			label[c] = len(result.SelectedClusters)
+			result.SelectedClusters = append(result.SelectedClusters, h.n+c)
+		}
+		result.Labels[i] = label[c]
+	}
+	membership := func(lambda, death float64) float64 {
+		if death == 0 || lambda >= death {
+			return 1
+		}
+		return lambda / death
+	}
+	for i := range result.Labels {
+		if result.Labels[i] != Noise {
+			result.Probabilities[i] = membership(pointLambda[i], death[result.SelectedClusters[result.Labels[i]]-h.n])
+		}
+		result.OutlierScores[i] = 1 - membership(pointLambda[i], death[pointParent[i]])
+	}
+	return result
+}
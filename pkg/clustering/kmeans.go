@@ -0,0 +1,316 @@
+package clustering
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	kdtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/kd_tree"
+)
+
+// KMeans partitions points into K clusters about their means with Lloyd's algorithm, seeded by
+// k-means++. Each step assigns points with the filtering algorithm of Kanungo et al., which
+// hands whole cells of a KdTree to a centre once every other centre is provably further away.
+// WeightedPoints count by their weight, as given by common.Weight.
+type KMeans struct {
+	K int
+	// Defaults to 300
+	MaxIterations int
+	// Stop once no centre moves further than this in an iteration
+	Tolerance float64
+	// Seeds the choice of initial centres, so that results are reproducible
+	Seed int64
+}
+
+type KMeansResult struct {
+	Centres []common.PointVector
+	// The centre of each input point
+	Labels []int
+	// The weighted sum of squared distances from each point to its centre
+	Inertia    float64
+	Iterations int
+}
+
+// A cell of the tree, with the sums needed to assign all of its points at once
+type kmeansNode struct {
+	min         common.PointVector
+	max         common.PointVector
+	pivot       common.PointVector
+	pivotWeight float64
+	// The points of the cell are order[first:last+1], the pivot coming first
+	first int
+	last  int
+	// Weighted sums over the points of the cell
+	weight     float64
+	sum        common.PointVector
+	sumSquares float64
+	left       *kmeansNode
+	right      *kmeansNode
+}
+
+type kmeansState struct {
+	root *kmeansNode
+	// The points of the tree in preorder, and the input index of each
+	points  []common.Point
+	order   []int
+	centres []common.PointVector
+	sums    []common.PointVector
+	weights []float64
+	// Candidate lists for each level of the recursion
+	scratch []int
+	// Only filled in on the final pass
+	labels  []int
+	inertia float64
+}
+
+// Clusters the points, which must be exactly the points the tree was constructed from. As with
+// DBSCAN, points are matched to the tree by their coordinates.
+func (kmeans KMeans) Fit(tree *kdtree.KdTree, points []common.Point) (*KMeansResult, error) {
+	if kmeans.K <= 0 || kmeans.K > len(points) {
+		return nil, fmt.Errorf("K must be between 1 and the number of points %d, found %d", len(points), kmeans.K)
+	}
+	if kmeans.Tolerance < 0 {
+		return nil, fmt.Errorf("The tolerance must be non-negative, found %v", kmeans.Tolerance)
+	}
+	maxIterations := kmeans.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = 300
+	}
+	for _, p := range points {
+		if err := common.CheckDimension("query point", p.Dimension(), tree.Dimension); err != nil {
+			return nil, err
+		}
+		if w := common.Weight(p); !(w >= 0) || math.IsInf(w, 1) {
+			return nil, fmt.Errorf("Point weights must be finite and non-negative, found %v", w)
+		}
+	}
+
+	state := &kmeansState{points: make([]common.Point, 0, len(points))}
+	state.root = state.build(tree)
+	if len(state.points) != len(points) {
+		return nil, fmt.Errorf("The tree holds %d points, but %d points were given", len(state.points), len(points))
+	}
+	// Renumber the points of the tree by input index
+	var err error
+	if state.order, err = common.NewCoordinateIndex(points).Match(state.points); err != nil {
+		return nil, err
+	}
+	state.centres = kmeansPlusPlus(points, kmeans.K, rand.New(rand.NewSource(kmeans.Seed)))
+	state.scratch = make([]int, kmeans.K*(tree.Depth()+1))
+
+	result := &KMeansResult{}
+	for result.Iterations < maxIterations {
+		result.Iterations++
+		state.assign()
+		shift := 0.
+		for c, centre := range state.centres {
+			if state.weights[c] == 0 {
+				// Leave the centres of empty clusters where they are
+				continue
+			}
+			moved := make(common.PointVector, len(centre))
+			for i := range moved {
+				moved[i] = state.sums[c][i] / state.weights[c]
+			}
+			d, _ := common.Distance(centre, moved)
+			shift = math.Max(shift, d)
+			state.centres[c] = moved
+		}
+		if shift <= kmeans.Tolerance {
+			break
+		}
+	}
+	// Label the points against the final centres
+	state.labels = make([]int, len(points))
+	state.assign()
+	result.Centres = state.centres
+	result.Labels = state.labels
+	result.Inertia = state.inertia
+	return result, nil
+}
+
+// Gathers the cells of the tree, listing its points in preorder
+func (state *kmeansState) build(tree *kdtree.KdTree) *kmeansNode {
+	if tree == nil || tree.Root == nil {
+		return nil
+	}
+	weight := common.Weight(tree.Root.Data)
+	n := &kmeansNode{
+		min:         tree.Root.Min,
+		max:         tree.Root.Max,
+		pivot:       tree.Root.Vector,
+		pivotWeight: weight,
+		first:       len(state.points),
+		weight:      weight,
+		sum:         common.Map(tree.Root.Vector, func(v float64) float64 { return weight * v }),
+		sumSquares:  weight * squaredNorm(tree.Root.Vector),
+	}
+	state.points = append(state.points, tree.Root.Data)
+	n.left = state.build(tree.Left)
+	n.right = state.build(tree.Right)
+	for _, child := range []*kmeansNode{n.left, n.right} {
+		if child != nil {
+			for i := range n.sum {
+				n.sum[i] += child.sum[i]
+			}
+			n.weight += child.weight
+			n.sumSquares += child.sumSquares
+		}
+	}
+	n.last = len(state.points) - 1
+	return n
+}
+
+// Gathers the weighted sum and total weight of the points nearest each centre
+func (state *kmeansState) assign() {
+	k := len(state.centres)
+	state.sums = make([]common.PointVector, k)
+	state.weights = make([]float64, k)
+	for c := range state.sums {
+		state.sums[c] = make(common.PointVector, len(state.centres[c]))
+	}
+	state.inertia = 0
+	candidates := state.scratch[:k]
+	for c := range candidates {
+		candidates[c] = c
+	}
+	state.filter(state.root, candidates, state.scratch[k:])
+}
+
+func (state *kmeansState) filter(n *kmeansNode, candidates []int, scratch []int) {
+	// The candidate nearest the middle of the cell, the lowest numbered on ties
+	closest, closestDistance := -1, math.Inf(1)
+	for _, c := range candidates {
+		d := 0.
+		for i, v := range state.centres[c] {
+			offset := v - (n.min[i]+n.max[i])/2
+			d += offset * offset
+		}
+		if d < closestDistance || (d == closestDistance && c < closest) {
+			closest, closestDistance = c, d
+		}
+	}
+	// Keep the centres which are nearer than the closest to some part of the cell
+	remaining := scratch[:0]
+	for _, c := range candidates {
+		if c == closest || !state.dominates(closest, c, n) {
+			remaining = append(remaining, c)
+		}
+	}
+	if len(remaining) == 1 {
+		state.assignCell(n, closest)
+		return
+	}
+	state.assignPoint(n.first, n.pivot, n.pivotWeight, state.nearest(n.pivot, remaining))
+	for _, child := range []*kmeansNode{n.left, n.right} {
+		if child != nil {
+			state.filter(child, remaining, scratch[len(remaining):])
+		}
+	}
+}
+
+// Whether every point of the cell would be given centre a over centre b, ties going to the lowest
+// numbered. It suffices to check the corner of the cell furthest in the direction from a to b.
+func (state *kmeansState) dominates(a, b int, n *kmeansNode) bool {
+	dA, dB := 0., 0.
+	for i := range n.min {
+		corner := n.min[i]
+		if state.centres[b][i] > state.centres[a][i] {
+			corner = n.max[i]
+		}
+		dA += (corner - state.centres[a][i]) * (corner - state.centres[a][i])
+		dB += (corner - state.centres[b][i]) * (corner - state.centres[b][i])
+	}
+	return dB > dA || (dB == dA && a < b)
+}
+
+// Returns the candidate nearest the vector, the lowest numbered on ties
+func (state *kmeansState) nearest(vector common.PointVector, candidates []int) int {
+	best, bestDistance := -1, math.Inf(1)
+	for _, c := range candidates {
+		d, _ := common.Distance(vector, state.centres[c])
+		if d < bestDistance || (d == bestDistance && c < best) {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+func (state *kmeansState) assignPoint(position int, vector common.PointVector, weight float64, centre int) {
+	for i, v := range vector {
+		state.sums[centre][i] += weight * v
+	}
+	state.weights[centre] += weight
+	d, _ := common.Distance(vector, state.centres[centre])
+	state.inertia += weight * d * d
+	if state.labels != nil {
+		state.labels[state.order[position]] = centre
+	}
+}
+
+func (state *kmeansState) assignCell(n *kmeansNode, centre int) {
+	for i, v := range n.sum {
+		state.sums[centre][i] += v
+	}
+	state.weights[centre] += n.weight
+	// The weighted sum over the cell of |x - c|^2 expands to sum w|x|^2 - 2 c.sum wx + |c|^2 sum w
+	dot, _ := common.DotProduct(n.sum, state.centres[centre])
+	state.inertia += math.Max(0, n.sumSquares-2*dot+n.weight*squaredNorm(state.centres[centre]))
+	if state.labels != nil {
+		for _, index := range state.order[n.first : n.last+1] {
+			state.labels[index] = centre
+		}
+	}
+}
+
+// Picks the first centre with probability proportional to its weight and each further centre
+// with probability proportional to its weight times its squared distance from the nearest
+// centre already chosen
+func kmeansPlusPlus(points []common.Point, k int, random *rand.Rand) []common.PointVector {
+	weights := common.Map(points, common.Weight)
+	centres := []common.PointVector{append(common.PointVector{}, points[sample(weights, random)].Vector()...)}
+	distances := make([]float64, len(points))
+	scores := make([]float64, len(points))
+	for i := range distances {
+		distances[i] = math.Inf(1)
+	}
+	for len(centres) < k {
+		for i, p := range points {
+			d, _ := common.Distance(p.Vector(), centres[len(centres)-1])
+			distances[i] = math.Min(distances[i], d*d)
+			scores[i] = weights[i] * distances[i]
+		}
+		centres = append(centres, append(common.PointVector{}, points[sample(scores, random)].Vector()...))
+	}
+	return centres
+}
+
+// Picks an index with probability proportional to its score. When every score is zero, such as
+// when every point coincides with a centre, any choice is as good as another.
+func sample(scores []float64, random *rand.Rand) int {
+	total := 0.
+	for _, s := range scores {
+		total += s
+	}
+	if !(total > 0) {
+		return random.Intn(len(scores))
+	}
+	target := random.Float64() * total
+	last := 0
+	for i, s := range scores {
+		if s > 0 {
+			last = i
+		}
+		if target -= s; target < 0 {
+			return i
+		}
+	}
+	// Rounding may leave some of the target over
+	return last
+}
+
+func squaredNorm(vector common.PointVector) float64 {
+	norm := common.Norm(vector)
+	return norm * norm
+}
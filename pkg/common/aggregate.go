@@ -0,0 +1,59 @@
+package common
+
+import "math"
+
+// Aggregate is a monoid over points which a tree caches at every node, so that region queries
+// can combine whole subtrees without visiting their points. Combine must be associative and
+// commutative, with Identity as its identity, as points are combined in no particular order.
+type Aggregate struct {
+	Identity any
+	// The value of a single point
+	Lift    func(Point) any
+	Combine func(a, b any) any
+}
+
+// Creates an Aggregate from typed functions, so that values need only be asserted to V once
+// they come out of a query
+func NewAggregate[V any](identity V, lift func(Point) V, combine func(a, b V) V) Aggregate {
+	return Aggregate{
+		Identity: identity,
+		Lift:     func(p Point) any { return lift(p) },
+		Combine:  func(a, b any) any { return combine(a.(V), b.(V)) },
+	}
+}
+
+func SumAggregate(value func(Point) float64) Aggregate {
+	return NewAggregate(0., value, func(a, b float64) float64 { return a + b })
+}
+
+// The minimum of an empty set of points is +Inf
+func MinAggregate(value func(Point) float64) Aggregate {
+	return NewAggregate(math.Inf(1), value, math.Min)
+}
+
+// The maximum of an empty set of points is -Inf
+func MaxAggregate(value func(Point) float64) Aggregate {
+	return NewAggregate(math.Inf(-1), value, math.Max)
+}
+
+// Mean accumulates the values needed for an average
+type Mean struct {
+	Sum   float64
+	Count int
+}
+
+// The mean value, or NaN if there were no points
+func (m Mean) Value() float64 {
+	if m.Count == 0 {
+		return math.NaN()
+	}
+	return m.Sum / float64(m.Count)
+}
+
+func MeanAggregate(value func(Point) float64) Aggregate {
+	return NewAggregate(Mean{}, func(p Point) Mean {
+		return Mean{Sum: value(p), Count: 1}
+	}, func(a, b Mean) Mean {
+		return Mean{Sum: a.Sum + b.Sum, Count: a.Count + b.Count}
+	})
+}
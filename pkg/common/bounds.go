@@ -0,0 +1,88 @@
+package common
+
+import "math"
+
+// Bounds encloses every point of a subtree, either in the axis aligned box [Min, Max] or,
+// when Min is nil, in the ball of Radius about Centre.
+type Bounds struct {
+	Min    PointVector
+	Max    PointVector
+	Centre PointVector
+	Radius float64
+}
+
+// Subtree is a read-only view of a node of a space partitioning tree and everything below it,
+// which lets algorithms walk KdTree and BallTree nodes alike.
+type Subtree interface {
+	NodeDimension() int
+	// The point held at this node, or nil for an empty tree
+	Pivot() Point
+	Bounds() Bounds
+	// Either child may be nil
+	Children() (Subtree, Subtree)
+}
+
+func (b Bounds) IsBox() bool {
+	return b.Min != nil
+}
+
+// Upper bound on the distance between any two points inside the bounds
+func (b Bounds) Diameter() float64 {
+	if b.IsBox() {
+		d, _ := Distance(b.Min, b.Max)
+		return d
+	}
+	return 2 * b.Radius
+}
+
+// Lower bound on the distance from vector to any point inside the bounds
+func (b Bounds) MinDistance(vector PointVector) float64 {
+	if b.IsBox() {
+		return MinDistanceToBox(vector, b.Min, b.Max)
+	}
+	d, _ := Distance(vector, b.Centre)
+	return math.Max(0, d-b.Radius)
+}
+
+// Upper bound on the distance from vector to any point inside the bounds
+func (b Bounds) MaxDistance(vector PointVector) float64 {
+	if b.IsBox() {
+		return MaxDistanceToBox(vector, b.Min, b.Max)
+	}
+	d, _ := Distance(vector, b.Centre)
+	return d + b.Radius
+}
+
+// Lower bound on the distance between any point inside b and any point inside other
+func (b Bounds) MinDistanceTo(other Bounds) float64 {
+	switch {
+	case b.IsBox() && other.IsBox():
+		distance := 0.
+		for i := range b.Min {
+			gap := math.Max(0, math.Max(b.Min[i]-other.Max[i], other.Min[i]-b.Max[i]))
+			distance += gap * gap
+		}
+		return math.Sqrt(distance)
+	case b.IsBox():
+		return math.Max(0, b.MinDistance(other.Centre)-other.Radius)
+	default:
+		return math.Max(0, other.MinDistance(b.Centre)-b.Radius)
+	}
+}
+
+// Upper bound on the distance between any point inside b and any point inside other
+func (b Bounds) MaxDistanceTo(other Bounds) float64 {
+	switch {
+	case b.IsBox() && other.IsBox():
+		distance := 0.
+		for i := range b.Min {
+			span := math.Max(b.Max[i]-other.Min[i], other.Max[i]-b.Min[i])
+			distance += span * span
+		}
+		return math.Sqrt(distance)
+	case b.IsBox():
+		return b.MaxDistance(other.Centre) + other.Radius
+	default:
+		return other.MaxDistance(b.Centre) + b.Radius
+	}
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type DOTOptions struct {
+	// Add the coordinates of each node's point to its label, and the ID of an IdentifiedPoint
+	IncludePoints bool
+	// Draw each subtree below this depth as a single node giving its size. Zero draws every node.
+	MaxDepth int
+}
+
+// Writes the tree as a Graphviz digraph, labelling each node with the lines given by label, or
+// with "leaf" if neither it nor the options give any. Nodes are numbered in preorder and every
+// number is written in full, so that the same tree always gives the same output.
+func WriteDOT(w io.Writer, name string, tree Subtree, options DOTOptions, label func(Subtree) []string) error {
+	if options.MaxDepth < 0 {
+		return fmt.Errorf("The maximum depth must be non-negative, found %d", options.MaxDepth)
+	}
+	writer := &dotWriter{w: w, options: options, label: label}
+	writer.printf("digraph %s {\n\tnode [shape=box];\n", name)
+	if tree != nil && tree.Pivot() != nil {
+		writer.node(tree, 1)
+	}
+	writer.printf("}\n")
+	return writer.err
+}
+
+type dotWriter struct {
+	w       io.Writer
+	options DOTOptions
+	label   func(Subtree) []string
+	nodes   int
+	// The first error in writing, after which nothing more is written
+	err error
+}
+
+func (writer *dotWriter) printf(format string, args ...any) {
+	if writer.err == nil {
+		_, writer.err = fmt.Fprintf(writer.w, format, args...)
+	}
+}
+
+// Writes the subtree, numbering its root with the next free number
+func (writer *dotWriter) node(tree Subtree, depth int) {
+	id := writer.nodes
+	writer.nodes++
+	if writer.options.MaxDepth > 0 && depth > writer.options.MaxDepth {
+		size := subtreeSize(tree)
+		summary := fmt.Sprintf("%d points", size)
+		if size == 1 {
+			summary = "1 point"
+		}
+		writer.printf("\tn%d [label=%s, style=dashed];\n", id, dotString([]string{summary}))
+		return
+	}
+	lines := writer.label(tree)
+	if writer.options.IncludePoints {
+		point := tree.Pivot()
+		if identified, ok := point.(IdentifiedPoint); ok {
+			lines = append(lines, fmt.Sprintf("id %d", identified.ID()))
+		}
+		lines = append(lines, "point "+FormatVector(point.Vector()))
+	}
+	if len(lines) == 0 {
+		lines = []string{"leaf"}
+	}
+	writer.printf("\tn%d [label=%s];\n", id, dotString(lines))
+	left, right := tree.Children()
+	for _, child := range []struct {
+		tree Subtree
+		side string
+	}{{left, "left"}, {right, "right"}} {
+		if child.tree != nil {
+			writer.printf("\tn%d -> n%d [label=%s];\n", id, writer.nodes, dotString([]string{child.side}))
+			writer.node(child.tree, depth+1)
+		}
+	}
+}
+
+func subtreeSize(tree Subtree) int {
+	result := 1
+	left, right := tree.Children()
+	for _, child := range []Subtree{left, right} {
+		if child != nil {
+			result += subtreeSize(child)
+		}
+	}
+	return result
+}
+
+// Formats the vector as (x, y, ...), writing each ordinate in full
+func FormatVector(vector PointVector) string {
+	return "(" + strings.Join(Map(vector, FormatFloat), ", ") + ")"
+}
+
+// Formats the value with as few digits as will read back exactly
+func FormatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// Quotes the lines as a DOT string, broken across lines
+func dotString(lines []string) string {
+	escaped := Map(lines, func(line string) string {
+		return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(line)
+	})
+	return `"` + strings.Join(escaped, `\n`) + `"`
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors, which the typed errors below match under errors.Is
+var (
+	ErrDimensionMismatch = errors.New("The dimensions do not match")
+	// Returned by nearest neighbour queries, which have no answer on an empty tree. Range
+	// queries simply find nothing.
+	ErrEmptyTree     = errors.New("The tree holds no points")
+	ErrInvalidK      = errors.New("k must be positive")
+	ErrInvalidRadius = errors.New("The radius must be non-negative")
+	// Returned for a tree or point of zero or negative dimension
+	ErrInvalidDimension = errors.New("The dimension must be positive")
+	ErrDuplicateID      = errors.New("The ID is shared by more than one point")
+	ErrNoFacilities     = errors.New("A facilities tree is required for bichromatic reverse nearest neighbour queries")
+	ErrNoAggregate      = errors.New("The tree was not constructed with an aggregate")
+)
+
+// DimensionError reports a point, region or tree whose dimension differs from that of a tree
+type DimensionError struct {
+	// What was given, such as "query point"
+	Subject   string
+	Dimension int
+	// The dimension of the tree
+	Expected int
+}
+
+func (e *DimensionError) Error() string {
+	return fmt.Sprintf("The %s has dimension %d, but the nodes of the tree are of dimension %d", e.Subject, e.Dimension, e.Expected)
+}
+
+func (e *DimensionError) Is(target error) bool {
+	return target == ErrDimensionMismatch
+}
+
+type InvalidDimensionError struct {
+	// What was given, such as "point"
+	Subject   string
+	Dimension int
+}
+
+func (e *InvalidDimensionError) Error() string {
+	return fmt.Sprintf("The %s must have positive dimension, found %d", e.Subject, e.Dimension)
+}
+
+func (e *InvalidDimensionError) Is(target error) bool {
+	return target == ErrInvalidDimension
+}
+
+type DuplicateIDError struct {
+	ID int
+}
+
+func (e *DuplicateIDError) Error() string {
+	return fmt.Sprintf("The ID %d is shared by more than one point", e.ID)
+}
+
+func (e *DuplicateIDError) Is(target error) bool {
+	return target == ErrDuplicateID
+}
+
+type InvalidKError struct {
+	K int
+}
+
+func (e *InvalidKError) Error() string {
+	return fmt.Sprintf("k must be positive, found %d", e.K)
+}
+
+func (e *InvalidKError) Is(target error) bool {
+	return target == ErrInvalidK
+}
+
+type InvalidRadiusError struct {
+	Radius float64
+}
+
+func (e *InvalidRadiusError) Error() string {
+	return fmt.Sprintf("The radius must be non-negative, found %v", e.Radius)
+}
+
+func (e *InvalidRadiusError) Is(target error) bool {
+	return target == ErrInvalidRadius
+}
+
+// Returns a DimensionError if the subject's dimension differs from the tree's
+func CheckDimension(subject string, dimension, expected int) error {
+	if dimension != expected {
+		return &DimensionError{Subject: subject, Dimension: dimension, Expected: expected}
+	}
+	return nil
+}
+
+// Returns an InvalidDimensionError unless the dimension is positive
+func CheckPositiveDimension(subject string, dimension int) error {
+	if dimension <= 0 {
+		return &InvalidDimensionError{Subject: subject, Dimension: dimension}
+	}
+	return nil
+}
+
+// Returns an InvalidKError unless k is positive
+func CheckK(k int) error {
+	if k <= 0 {
+		return &InvalidKError{K: k}
+	}
+	return nil
+}
+
+// Returns an InvalidRadiusError unless the radius is non-negative, which NaN is not
+func CheckRadius(radius float64) error {
+	if !(radius >= 0) {
+		return &InvalidRadiusError{Radius: radius}
+	}
+	return nil
+}
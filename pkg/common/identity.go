@@ -0,0 +1,216 @@
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// IdentifiedPoint is a point with a stable identifier, so that results can be joined back to
+// their source, and points looked up or deleted, without comparing interface values
+type IdentifiedPoint interface {
+	Point
+	ID() int
+}
+
+// IndexedPoint is the point made for each vector by IndexPoints, identified by its position
+// in the input
+type IndexedPoint struct {
+	Index       int
+	Coordinates PointVector
+}
+
+func (p *IndexedPoint) Dimension() int {
+	return len(p.Coordinates)
+}
+
+func (p *IndexedPoint) Vector() PointVector {
+	return p.Coordinates
+}
+
+func (p *IndexedPoint) ID() int {
+	return p.Index
+}
+
+// Wraps each vector in an IndexedPoint, so that query results can be read as indices into
+// the input
+func IndexPoints(vectors [][]float64) []Point {
+	result := make([]Point, len(vectors))
+	for i, v := range vectors {
+		result[i] = &IndexedPoint{Index: i, Coordinates: v}
+	}
+	return result
+}
+
+// Returns the ID of each point, which must all be IdentifiedPoints
+func IDs(points []Point) ([]int, error) {
+	result := make([]int, len(points))
+	for i, p := range points {
+		identified, ok := p.(IdentifiedPoint)
+		if !ok {
+			return nil, fmt.Errorf("The point %v has no ID", p.Vector())
+		}
+		result[i] = identified.ID()
+	}
+	return result, nil
+}
+
+// IDIndex maps the IDs of the IdentifiedPoints of a tree to the points. A nil index has not been
+// built, as for a tree read from JSON, and lookups scan the points of the tree instead.
+type IDIndex map[int]Point
+
+// Indexes the IdentifiedPoints among the points, skipping any others. IDs must be unique.
+func NewIDIndex(points []Point) (IDIndex, error) {
+	result := make(IDIndex)
+	for _, p := range points {
+		identified, ok := p.(IdentifiedPoint)
+		if !ok {
+			continue
+		}
+		if _, ok := result[identified.ID()]; ok {
+			return nil, &DuplicateIDError{ID: identified.ID()}
+		}
+		result[identified.ID()] = p
+	}
+	return result, nil
+}
+
+// Returns the point with the given ID, scanning the points of the tree if the index is nil
+func (index IDIndex) Lookup(id int, points func() []Point) (Point, bool) {
+	if index != nil {
+		p, ok := index[id]
+		return p, ok
+	}
+	for _, p := range points() {
+		if identified, ok := p.(IdentifiedPoint); ok && identified.ID() == id {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Adds a point about to be inserted into the tree, first building the index from the points of
+// the tree if it is nil
+func (index *IDIndex) Track(point Point, points func() []Point) error {
+	identified, ok := point.(IdentifiedPoint)
+	if !ok {
+		return nil
+	}
+	if *index == nil {
+		built, err := NewIDIndex(points())
+		if err != nil {
+			return err
+		}
+		*index = built
+	}
+	if _, ok := (*index)[identified.ID()]; ok {
+		return &DuplicateIDError{ID: identified.ID()}
+	}
+	(*index)[identified.ID()] = point
+	return nil
+}
+
+// Removes a point deleted from the tree
+func (index IDIndex) Untrack(point Point) {
+	if identified, ok := point.(IdentifiedPoint); ok {
+		delete(index, identified.ID())
+	}
+}
+
+// Constructs the tree from raw vectors, each wrapped in an IndexedPoint whose ID is its index.
+// The dimension is that of the first vector.
+func ConstructIndexed(tree SpacePartitioningTree, vectors [][]float64, options ...ConstructOption) error {
+	dimension := 0
+	if len(vectors) > 0 {
+		dimension = len(vectors[0])
+	}
+	return tree.Construct(IndexPoints(vectors), dimension, options...)
+}
+
+// Returns the IDs of the points of the tree strictly within distance of the query vector. The
+// points must all be IdentifiedPoints.
+func SearchIDs(tree SpacePartitioningTree, vector PointVector, distance float64) ([]int, error) {
+	result, err := tree.Search(&IndexedPoint{Index: -1, Coordinates: vector}, distance)
+	if err != nil {
+		return nil, err
+	}
+	return IDs(result)
+}
+
+// Returns the IDs of the k points of the tree nearest to the query vector, nearest first. The
+// points must all be IdentifiedPoints.
+func KNearestNeighborIDs(tree SpacePartitioningTree, vector PointVector, k int) ([]int, error) {
+	result, err := tree.KNearestNeighbors(&IndexedPoint{Index: -1, Coordinates: vector}, k)
+	if err != nil {
+		return nil, err
+	}
+	return IDs(result)
+}
+
+// CoordinateIndex maps coordinates to the positions in a slice of the points there, so that the
+// points found by queries on a tree of them can be matched back to the slice without comparing
+// points, which need not be comparable, or asking them for IDs
+type CoordinateIndex map[string][]int
+
+func NewCoordinateIndex(points []Point) CoordinateIndex {
+	result := make(CoordinateIndex, len(points))
+	for i, p := range points {
+		key := coordinateKey(p.Vector())
+		result[key] = append(result[key], i)
+	}
+	return result
+}
+
+// Returns the positions of the points with the same coordinates as p, in order
+func (index CoordinateIndex) Of(p Point) []int {
+	return index[coordinateKey(p.Vector())]
+}
+
+// Matches each point, such as those of a tree built from the slice, to a distinct position among
+// those with its coordinates, taking them in order
+func (index CoordinateIndex) Match(points []Point) ([]int, error) {
+	used := map[string]int{}
+	result := make([]int, len(points))
+	for i, p := range points {
+		key := coordinateKey(p.Vector())
+		group := index[key]
+		if used[key] == len(group) {
+			return nil, fmt.Errorf("The point %v was not given", p.Vector())
+		}
+		result[i] = group[used[key]]
+		used[key]++
+	}
+	return result, nil
+}
+
+// The bits of the coordinates, with negative zero read as zero
+func coordinateKey(vector PointVector) string {
+	key := make([]byte, 8*len(vector))
+	for i, v := range vector {
+		if v == 0 {
+			v = 0
+		}
+		binary.LittleEndian.PutUint64(key[8*i:], math.Float64bits(v))
+	}
+	return string(key)
+}
+
+// Whether a point of a tree stands for the given point: the point with the same ID if the given
+// point is an IdentifiedPoint, and otherwise a point with the same coordinates. Points are never
+// compared directly, as they need not be comparable.
+func SamePoint(point, candidate Point) bool {
+	if identified, ok := point.(IdentifiedPoint); ok {
+		other, ok := candidate.(IdentifiedPoint)
+		return ok && other.ID() == identified.ID()
+	}
+	a, b := point.Vector(), candidate.Vector()
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,10 +2,18 @@ package common
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 )
 
-func FindMedianByOrdering(ordering []float64, points []Point) (Point, []Point, []Point, error) {
+// Partitions the points about their weighted median under the ordering, so that the points
+// before the pivot weigh at most half the total and those before and including it weigh more.
+// Points which are not WeightedPoints weigh one, so for them the pivot is the element at index
+// len(points) / 2 of the sorted order. Weights must be finite and non-negative, and when they
+// total zero the points are split about the median by count instead. Pivots are drawn from
+// random, or from the global source if it is nil, so a seeded source gives the same partition
+// every time.
+func FindMedianByOrdering(ordering []float64, points []Point, random *rand.Rand) (Point, []Point, []Point, error) {
 	if len(ordering) != len(points) {
 		return nil, nil, nil, fmt.Errorf("The ordering slice and points slice must have the same length")
 	}
@@ -13,31 +21,57 @@ func FindMedianByOrdering(ordering []float64, points []Point) (Point, []Point, [
 		return nil, nil, nil, fmt.Errorf("No data passed to FindMedianByOrdering")
 	}
 
+	total := 0.
+	for _, p := range points {
+		w := Weight(p)
+		if !(w >= 0) || math.IsInf(w, 1) {
+			return nil, nil, nil, fmt.Errorf("Point weights must be finite and non-negative, found %v", w)
+		}
+		total += w
+	}
+	if math.IsInf(total, 1) {
+		return nil, nil, nil, fmt.Errorf("The points must have a finite total weight, found %v", total)
+	}
+	weigh := Weight
+	if total == 0 {
+		weigh = func(Point) float64 { return 1 }
+		total = float64(len(points))
+	}
+
 	n := len(ordering)
-	k := len(ordering) / 2
-	pivot, smaller, larger := quickSelect(ordering, points, 0, n-1, k)
+	pivot, smaller, larger := quickSelect(ordering, points, 0, n-1, total/2, weigh, random)
 	return pivot, smaller, larger, nil
 }
 
-func quickSelect(ordering []float64, points []Point, l, r, k int) (Point, []Point, []Point) {
-	if l == r { // If the list contains only one element,
-		return points[l], points[:l], points[l+1:] // return that element
-	}
-	var pivotIndex int
+// Selects the element k at which the weight of points[:k] is at most half and that of
+// points[:k+1] exceeds it, weighing points with weigh. The weight of points[:l] is always kept
+// at most half, and that of points[:r+1] above it.
+func quickSelect(ordering []float64, points []Point, l, r int, half float64, weigh func(Point) float64, random *rand.Rand) (Point, []Point, []Point) {
+	below := 0.
 	for l < r {
-
-		pivotIndex = rand.Intn(r+1-l) + l
+		var pivotIndex int
+		if random != nil {
+			pivotIndex = random.Intn(r+1-l) + l
+		} else {
+			pivotIndex = rand.Intn(r+1-l) + l
+		}
 		pivotIndex = partition(ordering, points, l, r, pivotIndex)
 
-		if k < pivotIndex {
+		weight := below
+		for _, p := range points[l:pivotIndex] {
+			weight += weigh(p)
+		}
+		if weight > half {
 			r = pivotIndex - 1
-		} else if k > pivotIndex {
+		} else if weight += weigh(points[pivotIndex]); weight <= half {
+			below = weight
 			l = pivotIndex + 1
 		} else {
+			l = pivotIndex
 			break
 		}
 	}
-	return points[k], points[:k], points[k+1:]
+	return points[l], points[:l], points[l+1:]
 }
 
 func partition(ordering []float64, points []Point, l, r, pivotIndex int) int {
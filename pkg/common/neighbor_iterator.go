@@ -0,0 +1,77 @@
+package common
+
+import "container/heap"
+
+// Expands a tree node during distance browsing. The node's own point is passed to emit with its
+// exact distance from the query, and each child to visit with a lower bound on the distance from
+// the query to any point below it.
+type ExpandFunc func(node any, visit func(child any, lowerBound float64), emit func(point Point, distance float64))
+
+// NeighborIterator yields the points of a tree in increasing distance from a query point,
+// using the Hjaltason-Samet distance browsing algorithm. Nodes and points share a single
+// priority queue, so the work done depends on how many points are consumed, not on the tree size.
+type NeighborIterator struct {
+	queue  browseQueue
+	expand ExpandFunc
+	visit  func(child any, lowerBound float64)
+	emit   func(point Point, distance float64)
+}
+
+type browseEntry struct {
+	node     any
+	point    Point
+	distance float64
+}
+
+type browseQueue []browseEntry
+
+func (q browseQueue) Len() int {
+	return len(q)
+}
+
+func (q browseQueue) Less(i, j int) bool {
+	return q[i].distance < q[j].distance
+}
+
+func (q browseQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *browseQueue) Push(x interface{}) {
+	*q = append(*q, x.(browseEntry))
+}
+
+func (q *browseQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	x := old[n-1]
+	*q = old[:n-1]
+	return x
+}
+
+// Creates an iterator starting from root, which is ignored if nil
+func NewNeighborIterator(root any, expand ExpandFunc) *NeighborIterator {
+	it := &NeighborIterator{expand: expand}
+	it.visit = func(child any, lowerBound float64) {
+		heap.Push(&it.queue, browseEntry{node: child, distance: lowerBound})
+	}
+	it.emit = func(point Point, distance float64) {
+		heap.Push(&it.queue, browseEntry{point: point, distance: distance})
+	}
+	if root != nil {
+		it.queue = browseQueue{{node: root}}
+	}
+	return it
+}
+
+// Returns the next nearest point and its distance from the query, or false once the tree is exhausted
+func (it *NeighborIterator) Next() (Point, float64, bool) {
+	for len(it.queue) > 0 {
+		entry := heap.Pop(&it.queue).(browseEntry)
+		if entry.node == nil {
+			return entry.point, entry.distance, true
+		}
+		it.expand(entry.node, it.visit, it.emit)
+	}
+	return nil, 0, false
+}
@@ -0,0 +1,67 @@
+package common
+
+import "math/rand"
+
+// ConstructOption changes how a tree is constructed
+type ConstructOption func(*ConstructOptions)
+
+// ConstructOptions collects the settings made by a list of ConstructOption
+type ConstructOptions struct {
+	// Cached at every node when set
+	Aggregate *Aggregate
+	// Fail on any point which cannot be placed in the tree
+	Strict bool
+	// Filled in with the points dropped, when set
+	Report *ConstructReport
+	// The source of the random choices made during construction. The global source is used
+	// when nil.
+	Random *rand.Rand
+}
+
+func NewConstructOptions(options ...ConstructOption) ConstructOptions {
+	result := ConstructOptions{}
+	for _, option := range options {
+		option(&result)
+	}
+	return result
+}
+
+// Caches the aggregate of every subtree, for AggregateRegion queries
+func WithAggregate(aggregate Aggregate) ConstructOption {
+	return func(options *ConstructOptions) {
+		options.Aggregate = &aggregate
+	}
+}
+
+// Makes construction fail with a RejectedPointsError, listing the offending input indices, if
+// any point has the wrong dimension or a NaN or infinite coordinate
+func WithStrict() ConstructOption {
+	return func(options *ConstructOptions) {
+		options.Strict = true
+	}
+}
+
+// Makes construction drop points with the wrong dimension or a NaN or infinite coordinate,
+// recording in the report how many were dropped and why
+func WithPermissive(report *ConstructReport) ConstructOption {
+	return func(options *ConstructOptions) {
+		options.Report = report
+	}
+}
+
+// Makes construction reproducible, so that building a tree twice from the same points with the
+// same seed gives identical trees
+func WithSeed(seed int64) ConstructOption {
+	return func(options *ConstructOptions) {
+		// A fresh source for each construction, so that the option may be reused
+		options.Random = rand.New(rand.NewSource(seed))
+	}
+}
+
+// Draws the random choices made during construction from the given source, which must not be
+// used concurrently elsewhere
+func WithRandom(random *rand.Rand) ConstructOption {
+	return func(options *ConstructOptions) {
+		options.Random = random
+	}
+}
@@ -30,3 +30,10 @@ func (h *PointWithDistanceHeap) Pop() interface{} {
 	*h = old[:n-1]
 	return x
 }
+
+// PointPair is a pair of points and the distance between them
+type PointPair struct {
+	A        Point
+	B        Point
+	Distance float64
+}
@@ -0,0 +1,182 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+// Polygon is a 2-D region bounded by one or more closed rings. Rings are combined with the
+// even-odd rule, so the polygon may be non-convex and any ring nested in another is a hole.
+// Polygons are built with NewPolygon; the zero value is empty and contains no points.
+type Polygon struct {
+	rings [][]PointVector
+	// Bounding box and bounding circle of every vertex, cached for cheap rejection
+	min    PointVector
+	max    PointVector
+	centre PointVector
+	radius float64
+}
+
+var _ ContainingRegion = Polygon{}
+
+// Creates a polygon from its outer ring and any holes. Rings are implicitly closed, so the
+// last vertex should not repeat the first.
+func NewPolygon(outer []PointVector, holes ...[]PointVector) (Polygon, error) {
+	rings := append([][]PointVector{outer}, holes...)
+	polygon := Polygon{
+		rings: rings,
+		min:   PointVector{math.Inf(1), math.Inf(1)},
+		max:   PointVector{math.Inf(-1), math.Inf(-1)},
+	}
+	for _, ring := range rings {
+		if len(ring) < 3 {
+			return Polygon{}, fmt.Errorf("Polygon rings must have at least 3 vertices, found %d", len(ring))
+		}
+		for _, vertex := range ring {
+			if len(vertex) != 2 {
+				return Polygon{}, fmt.Errorf("Polygon vertices must have dimension 2, found %d", len(vertex))
+			}
+			for i, v := range vertex {
+				polygon.min[i] = math.Min(polygon.min[i], v)
+				polygon.max[i] = math.Max(polygon.max[i], v)
+			}
+		}
+	}
+	polygon.centre = PointVector{(polygon.min[0] + polygon.max[0]) / 2, (polygon.min[1] + polygon.max[1]) / 2}
+	for _, vertex := range outer {
+		d, _ := Distance(vertex, polygon.centre)
+		polygon.radius = math.Max(polygon.radius, d)
+	}
+	return polygon, nil
+}
+
+func (p Polygon) Dimension() int {
+	return 2
+}
+
+// Ray casting point in polygon test
+func (p Polygon) Contains(vector PointVector) bool {
+	if len(vector) != 2 {
+		return false
+	}
+	x, y := vector[0], vector[1]
+	inside := false
+	for _, ring := range p.rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			xi, yi := ring[i][0], ring[i][1]
+			xj, yj := ring[j][0], ring[j][1]
+			if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// Exact test - after clipping the box to the bounding box of the polygon, the two overlap
+// if and only if an edge of the polygon crosses the box, or the box lies wholly inside.
+func (p Polygon) IntersectsBox(min, max PointVector) bool {
+	if p.isEmpty() {
+		return false
+	}
+	clippedMin := PointVector{math.Max(min[0], p.min[0]), math.Max(min[1], p.min[1])}
+	clippedMax := PointVector{math.Min(max[0], p.max[0]), math.Min(max[1], p.max[1])}
+	if clippedMin[0] > clippedMax[0] || clippedMin[1] > clippedMax[1] {
+		return false
+	}
+	for _, ring := range p.rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			if segmentIntersectsBox(ring[j], ring[i], clippedMin, clippedMax) {
+				return true
+			}
+		}
+	}
+	// No edge meets the box, so it is either entirely inside or entirely outside
+	return p.Contains(clippedMin)
+}
+
+// Bounding circle test, so this is conservative
+func (p Polygon) IntersectsBall(centre PointVector, radius float64) bool {
+	if p.isEmpty() {
+		return false
+	}
+	d, _ := Distance(centre, p.centre)
+	return d-radius <= p.radius
+}
+
+// The box lies inside if no edge meets it and one of its corners is inside
+func (p Polygon) ContainsBox(min, max PointVector) bool {
+	if p.isEmpty() {
+		return false
+	}
+	if min[0] < p.min[0] || min[1] < p.min[1] || max[0] > p.max[0] || max[1] > p.max[1] {
+		return false
+	}
+	for _, ring := range p.rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			if segmentIntersectsBox(ring[j], ring[i], min, max) {
+				return false
+			}
+		}
+	}
+	return p.Contains(min)
+}
+
+// The ball lies inside if its centre does and every edge is further away than its radius
+func (p Polygon) ContainsBall(centre PointVector, radius float64) bool {
+	if !p.Contains(centre) {
+		return false
+	}
+	for _, ring := range p.rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			if distanceToSegment(centre, ring[j], ring[i]) <= radius {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// The zero value has no rings, and none of the bounds cached by NewPolygon
+func (p Polygon) isEmpty() bool {
+	return len(p.rings) == 0
+}
+
+// Liang-Barsky clipping of the segment from start to end against a bounded box
+func segmentIntersectsBox(start, end, min, max PointVector) bool {
+	t0, t1 := 0., 1.
+	for i := range start {
+		delta := end[i] - start[i]
+		if delta == 0 {
+			if start[i] < min[i] || start[i] > max[i] {
+				return false
+			}
+			continue
+		}
+		tNear := (min[i] - start[i]) / delta
+		tFar := (max[i] - start[i]) / delta
+		if tNear > tFar {
+			tNear, tFar = tFar, tNear
+		}
+		t0 = math.Max(t0, tNear)
+		t1 = math.Min(t1, tFar)
+		if t0 > t1 {
+			return false
+		}
+	}
+	return true
+}
+
+func distanceToSegment(vector, start, end PointVector) float64 {
+	direction, _ := Difference(start, end)
+	offset, _ := Difference(start, vector)
+	length, _ := DotProduct(direction, direction)
+	t := 0.
+	if length > 0 {
+		projection, _ := DotProduct(offset, direction)
+		t = math.Max(0, math.Min(1, projection/length))
+	}
+	nearest := PointVector{start[0] + t*direction[0], start[1] + t*direction[1]}
+	d, _ := Distance(vector, nearest)
+	return d
+}
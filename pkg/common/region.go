@@ -0,0 +1,443 @@
+package common
+
+import "math"
+
+// A Region is an arbitrary subset of space which can be queried on a SpacePartitioningTree.
+// The overlap tests are used to prune subtrees and must be conservative: they may only
+// return false when no point of the box or ball can lie inside the region.
+type Region interface {
+	Dimension() int
+	Contains(vector PointVector) bool
+	IntersectsBox(min, max PointVector) bool
+	IntersectsBall(centre PointVector, radius float64) bool
+}
+
+// ContainingRegion is a Region which can also tell when it holds the whole of a box or ball,
+// so that whole subtrees can be counted or aggregated without visiting their points. The
+// containment tests must also be conservative: they may only return true when every point
+// of the box or ball lies inside the region.
+type ContainingRegion interface {
+	Region
+	ContainsBox(min, max PointVector) bool
+	ContainsBall(centre PointVector, radius float64) bool
+}
+
+// Checks that a query region, and every region a Union, Intersection, Complement or
+// ConvexPolytope is built from, has the dimension of the tree
+func CheckRegion(region Region, expected int) error {
+	var members []Region
+	switch r := region.(type) {
+	case Union:
+		members = r
+	case Intersection:
+		members = r
+	case Complement:
+		members = []Region{r.Region}
+	case ConvexPolytope:
+		for _, face := range r.Faces {
+			members = append(members, face)
+		}
+	}
+	for _, member := range members {
+		if err := CheckRegion(member, expected); err != nil {
+			return err
+		}
+	}
+	return CheckDimension("query region", region.Dimension(), expected)
+}
+
+var (
+	_ ContainingRegion = Sphere{}
+	_ ContainingRegion = Box{}
+	_ ContainingRegion = Annulus{}
+	_ ContainingRegion = HalfSpace{}
+	_ ContainingRegion = ConvexPolytope{}
+	_ ContainingRegion = Union{}
+	_ ContainingRegion = Intersection{}
+	_ ContainingRegion = Complement{}
+)
+
+// Sphere contains the points strictly closer than Radius to Centre, matching the
+// semantics of SpacePartitioningTree.Search
+type Sphere struct {
+	Centre PointVector `json:"centre"`
+	Radius float64     `json:"radius"`
+}
+
+func (s Sphere) Dimension() int {
+	return len(s.Centre)
+}
+
+func (s Sphere) Contains(vector PointVector) bool {
+	d, err := Distance(vector, s.Centre)
+	return err == nil && d < s.Radius
+}
+
+func (s Sphere) IntersectsBox(min, max PointVector) bool {
+	return MinDistanceToBox(s.Centre, min, max) <= s.Radius
+}
+
+func (s Sphere) IntersectsBall(centre PointVector, radius float64) bool {
+	d, _ := Distance(centre, s.Centre)
+	return d-radius <= s.Radius
+}
+
+func (s Sphere) ContainsBox(min, max PointVector) bool {
+	return MaxDistanceToBox(s.Centre, min, max) < s.Radius
+}
+
+func (s Sphere) ContainsBall(centre PointVector, radius float64) bool {
+	d, _ := Distance(centre, s.Centre)
+	return d+radius < s.Radius
+}
+
+// Box is the closed axis aligned box [Min, Max]
+type Box struct {
+	Min PointVector `json:"min"`
+	Max PointVector `json:"max"`
+}
+
+func (b Box) Dimension() int {
+	return len(b.Min)
+}
+
+func (b Box) Contains(vector PointVector) bool {
+	if len(vector) != len(b.Min) {
+		return false
+	}
+	for i, v := range vector {
+		if v < b.Min[i] || v > b.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Box) IntersectsBox(min, max PointVector) bool {
+	for i := range b.Min {
+		if math.Max(b.Min[i], min[i]) > math.Min(b.Max[i], max[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Box) IntersectsBall(centre PointVector, radius float64) bool {
+	return MinDistanceToBox(centre, b.Min, b.Max) <= radius
+}
+
+func (b Box) ContainsBox(min, max PointVector) bool {
+	for i := range b.Min {
+		if min[i] < b.Min[i] || max[i] > b.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Box) ContainsBall(centre PointVector, radius float64) bool {
+	for i := range b.Min {
+		if centre[i]-radius < b.Min[i] || centre[i]+radius > b.Max[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Annulus contains the points whose distance from Centre lies in [InnerRadius, OuterRadius)
+type Annulus struct {
+	Centre      PointVector `json:"centre"`
+	InnerRadius float64     `json:"innerRadius"`
+	OuterRadius float64     `json:"outerRadius"`
+}
+
+func (a Annulus) Dimension() int {
+	return len(a.Centre)
+}
+
+func (a Annulus) Contains(vector PointVector) bool {
+	d, err := Distance(vector, a.Centre)
+	return err == nil && d >= a.InnerRadius && d < a.OuterRadius
+}
+
+func (a Annulus) IntersectsBox(min, max PointVector) bool {
+	return MinDistanceToBox(a.Centre, min, max) <= a.OuterRadius && MaxDistanceToBox(a.Centre, min, max) >= a.InnerRadius
+}
+
+func (a Annulus) IntersectsBall(centre PointVector, radius float64) bool {
+	d, _ := Distance(centre, a.Centre)
+	return d-radius <= a.OuterRadius && d+radius >= a.InnerRadius
+}
+
+func (a Annulus) ContainsBox(min, max PointVector) bool {
+	return MinDistanceToBox(a.Centre, min, max) >= a.InnerRadius && MaxDistanceToBox(a.Centre, min, max) < a.OuterRadius
+}
+
+func (a Annulus) ContainsBall(centre PointVector, radius float64) bool {
+	d, _ := Distance(centre, a.Centre)
+	return d-radius >= a.InnerRadius && d+radius < a.OuterRadius
+}
+
+// HalfSpace contains the points x satisfying Normal . x <= Offset
+type HalfSpace struct {
+	Normal PointVector `json:"normal"`
+	Offset float64     `json:"offset"`
+}
+
+func (h HalfSpace) Dimension() int {
+	return len(h.Normal)
+}
+
+func (h HalfSpace) Contains(vector PointVector) bool {
+	dotProduct, err := DotProduct(h.Normal, vector)
+	return err == nil && dotProduct <= h.Offset
+}
+
+func (h HalfSpace) IntersectsBox(min, max PointVector) bool {
+	// The smallest value of Normal . x over the box is attained at the corner
+	// picked out by the signs of the normal
+	lowest := 0.
+	for i, n := range h.Normal {
+		if n > 0 {
+			lowest += n * min[i]
+		} else if n < 0 {
+			lowest += n * max[i]
+		}
+	}
+	return lowest <= h.Offset
+}
+
+func (h HalfSpace) IntersectsBall(centre PointVector, radius float64) bool {
+	dotProduct, _ := DotProduct(h.Normal, centre)
+	return dotProduct-radius*Norm(h.Normal) <= h.Offset
+}
+
+func (h HalfSpace) ContainsBox(min, max PointVector) bool {
+	// The largest value of Normal . x over the box is attained at the opposite corner
+	highest := 0.
+	for i, n := range h.Normal {
+		if n > 0 {
+			highest += n * max[i]
+		} else if n < 0 {
+			highest += n * min[i]
+		}
+	}
+	return highest <= h.Offset
+}
+
+func (h HalfSpace) ContainsBall(centre PointVector, radius float64) bool {
+	dotProduct, _ := DotProduct(h.Normal, centre)
+	return dotProduct+radius*Norm(h.Normal) <= h.Offset
+}
+
+// ConvexPolytope is the intersection of a set of half spaces
+type ConvexPolytope struct {
+	Faces []HalfSpace `json:"faces"`
+}
+
+func (c ConvexPolytope) Dimension() int {
+	if len(c.Faces) == 0 {
+		return 0
+	}
+	return c.Faces[0].Dimension()
+}
+
+func (c ConvexPolytope) Contains(vector PointVector) bool {
+	for _, face := range c.Faces {
+		if !face.Contains(vector) {
+			return false
+		}
+	}
+	return true
+}
+
+// Conservative - the box may meet every face but still miss the polytope
+func (c ConvexPolytope) IntersectsBox(min, max PointVector) bool {
+	for _, face := range c.Faces {
+		if !face.IntersectsBox(min, max) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c ConvexPolytope) IntersectsBall(centre PointVector, radius float64) bool {
+	for _, face := range c.Faces {
+		if !face.IntersectsBall(centre, radius) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c ConvexPolytope) ContainsBox(min, max PointVector) bool {
+	for _, face := range c.Faces {
+		if !face.ContainsBox(min, max) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c ConvexPolytope) ContainsBall(centre PointVector, radius float64) bool {
+	for _, face := range c.Faces {
+		if !face.ContainsBall(centre, radius) {
+			return false
+		}
+	}
+	return true
+}
+
+// Union contains the points lying in any of its regions
+type Union []Region
+
+// The dimension shared by the regions, or -1 if they differ
+func (u Union) Dimension() int {
+	return sharedDimension(u)
+}
+
+func (u Union) Contains(vector PointVector) bool {
+	for _, region := range u {
+		if region.Contains(vector) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u Union) IntersectsBox(min, max PointVector) bool {
+	for _, region := range u {
+		if region.IntersectsBox(min, max) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u Union) IntersectsBall(centre PointVector, radius float64) bool {
+	for _, region := range u {
+		if region.IntersectsBall(centre, radius) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conservative - the box may be covered by several regions without lying inside any one
+func (u Union) ContainsBox(min, max PointVector) bool {
+	for _, region := range u {
+		if containing, ok := region.(ContainingRegion); ok && containing.ContainsBox(min, max) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u Union) ContainsBall(centre PointVector, radius float64) bool {
+	for _, region := range u {
+		if containing, ok := region.(ContainingRegion); ok && containing.ContainsBall(centre, radius) {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersection contains the points lying in every one of its regions
+type Intersection []Region
+
+// The dimension shared by the regions, or -1 if they differ
+func (in Intersection) Dimension() int {
+	return sharedDimension(in)
+}
+
+func sharedDimension(regions []Region) int {
+	if len(regions) == 0 {
+		return 0
+	}
+	dimension := regions[0].Dimension()
+	for _, region := range regions[1:] {
+		if region.Dimension() != dimension {
+			return -1
+		}
+	}
+	return dimension
+}
+
+func (in Intersection) Contains(vector PointVector) bool {
+	for _, region := range in {
+		if !region.Contains(vector) {
+			return false
+		}
+	}
+	return true
+}
+
+// Conservative - the box may meet every region but not their intersection
+func (in Intersection) IntersectsBox(min, max PointVector) bool {
+	for _, region := range in {
+		if !region.IntersectsBox(min, max) {
+			return false
+		}
+	}
+	return true
+}
+
+func (in Intersection) IntersectsBall(centre PointVector, radius float64) bool {
+	for _, region := range in {
+		if !region.IntersectsBall(centre, radius) {
+			return false
+		}
+	}
+	return true
+}
+
+func (in Intersection) ContainsBox(min, max PointVector) bool {
+	for _, region := range in {
+		if containing, ok := region.(ContainingRegion); !ok || !containing.ContainsBox(min, max) {
+			return false
+		}
+	}
+	return true
+}
+
+func (in Intersection) ContainsBall(centre PointVector, radius float64) bool {
+	for _, region := range in {
+		if containing, ok := region.(ContainingRegion); !ok || !containing.ContainsBall(centre, radius) {
+			return false
+		}
+	}
+	return true
+}
+
+// Complement contains the points which do not lie in Region
+type Complement struct {
+	Region Region
+}
+
+func (c Complement) Dimension() int {
+	return c.Region.Dimension()
+}
+
+func (c Complement) Contains(vector PointVector) bool {
+	return !c.Region.Contains(vector)
+}
+
+// The box misses the complement only if the inner region contains it, which can only be
+// known when the inner region is a ContainingRegion
+func (c Complement) IntersectsBox(min, max PointVector) bool {
+	containing, ok := c.Region.(ContainingRegion)
+	return !ok || !containing.ContainsBox(min, max)
+}
+
+func (c Complement) IntersectsBall(centre PointVector, radius float64) bool {
+	containing, ok := c.Region.(ContainingRegion)
+	return !ok || !containing.ContainsBall(centre, radius)
+}
+
+func (c Complement) ContainsBox(min, max PointVector) bool {
+	return !c.Region.IntersectsBox(min, max)
+}
+
+func (c Complement) ContainsBall(centre PointVector, radius float64) bool {
+	return !c.Region.IntersectsBall(centre, radius)
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"math"
+	"sort"
+)
+
+// TreeStats describes the shape of a tree. Depths count nodes from the root, as Depth does, so
+// a lone root has depth one.
+type TreeStats struct {
+	Nodes  int
+	Leaves int
+	// NodesPerLevel[i] is the number of nodes at depth i + 1
+	NodesPerLevel []int
+	// LeafDepths[i] is the number of leaves at depth i + 1
+	LeafDepths []int
+	// The mean depth of the leaves
+	AverageDepth float64
+	MaxDepth     int
+	// MaxDepth over the depth of a perfectly balanced tree of as many nodes, so one at best
+	ImbalanceRatio float64
+}
+
+// Walks a tree breadth first to describe its shape
+func NewTreeStats(tree Subtree) TreeStats {
+	result := TreeStats{NodesPerLevel: []int{}, LeafDepths: []int{}}
+	if tree == nil || tree.Pivot() == nil {
+		return result
+	}
+	level := []Subtree{tree}
+	depthSum := 0
+	for depth := 1; len(level) > 0; depth++ {
+		next := []Subtree{}
+		leaves := 0
+		for _, node := range level {
+			left, right := node.Children()
+			if left == nil && right == nil {
+				leaves++
+			}
+			for _, child := range []Subtree{left, right} {
+				if child != nil {
+					next = append(next, child)
+				}
+			}
+		}
+		result.Nodes += len(level)
+		result.Leaves += leaves
+		result.NodesPerLevel = append(result.NodesPerLevel, len(level))
+		result.LeafDepths = append(result.LeafDepths, leaves)
+		result.MaxDepth = depth
+		depthSum += depth * leaves
+		level = next
+	}
+	result.AverageDepth = float64(depthSum) / float64(result.Leaves)
+	result.ImbalanceRatio = float64(result.MaxDepth) / math.Ceil(math.Log2(float64(result.Nodes+1)))
+	return result
+}
+
+// Distribution summarises a sample of values
+type Distribution struct {
+	Count  int
+	Min    float64
+	Max    float64
+	Mean   float64
+	Median float64
+	// The 10th and 90th percentiles, by the nearest rank
+	P10 float64
+	P90 float64
+}
+
+// Summarises the values, leaving every field zero if there are none
+func NewDistribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	sum := 0.
+	for _, v := range sorted {
+		sum += v
+	}
+	percentile := func(p float64) float64 {
+		return sorted[max(int(math.Ceil(p*float64(len(sorted))))-1, 0)]
+	}
+	return Distribution{
+		Count:  len(sorted),
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		Mean:   sum / float64(len(sorted)),
+		Median: percentile(0.5),
+		P10:    percentile(0.1),
+		P90:    percentile(0.9),
+	}
+}
@@ -9,7 +9,7 @@ type Point interface {
 
 type SpacePartitioningTree interface {
 	// constructors
-	Construct(points []Point, dimension int) error
+	Construct(points []Point, dimension int, options ...ConstructOption) error
 	// accessors
 	Search(point Point, radius float64) ([]Point, error)
 	KNearestNeighbors(point Point, k int) ([]Point, error)
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// RejectionReason says why construction turned a point away
+type RejectionReason int
+
+const (
+	// The point's dimension differs from that of the tree
+	WrongDimension RejectionReason = iota
+	// The point has a NaN or infinite coordinate
+	NonFiniteCoordinate
+)
+
+func (r RejectionReason) String() string {
+	switch r {
+	case WrongDimension:
+		return "wrong dimension"
+	case NonFiniteCoordinate:
+		return "non-finite coordinate"
+	}
+	return fmt.Sprintf("RejectionReason(%d)", int(r))
+}
+
+// Rejection records a point turned away by construction, by its index in the input
+type Rejection struct {
+	Index  int
+	Reason RejectionReason
+}
+
+// RejectedPointsError is returned by strict construction when any point is rejected
+type RejectedPointsError struct {
+	Rejections []Rejection
+}
+
+func (e *RejectedPointsError) Error() string {
+	// Long lists are cut short, as the full list is on the error
+	shown := e.Rejections
+	if len(shown) > 10 {
+		shown = shown[:10]
+	}
+	parts := make([]string, len(shown))
+	for i, r := range shown {
+		parts[i] = fmt.Sprintf("%d (%v)", r.Index, r.Reason)
+	}
+	if len(shown) < len(e.Rejections) {
+		parts = append(parts, fmt.Sprintf("and %d more", len(e.Rejections)-len(shown)))
+	}
+	return fmt.Sprintf("%d points were rejected: %s", len(e.Rejections), strings.Join(parts, ", "))
+}
+
+// ConstructReport is filled in by permissive construction
+type ConstructReport struct {
+	// The number of points in the tree
+	Accepted   int
+	Rejections []Rejection
+}
+
+// The number of points rejected
+func (r ConstructReport) Dropped() int {
+	return len(r.Rejections)
+}
+
+// The number of points rejected for each reason
+func (r ConstructReport) Counts() map[RejectionReason]int {
+	result := map[RejectionReason]int{}
+	for _, rejection := range r.Rejections {
+		result[rejection.Reason]++
+	}
+	return result
+}
+
+// Returns the points a tree of the given dimension should be built from. By default points
+// of the wrong dimension are silently dropped. Strict construction rejects those and points
+// with NaN or infinite coordinates with a RejectedPointsError, while permissive construction
+// drops them and records why in its report.
+func (options ConstructOptions) Accept(points []Point, dimension int) ([]Point, error) {
+	if !options.Strict && options.Report == nil {
+		return Filter(points, func(p Point) bool {
+			return p.Dimension() == dimension
+		}), nil
+	}
+	accepted := make([]Point, 0, len(points))
+	rejections := []Rejection{}
+	for i, p := range points {
+		if p.Dimension() != dimension {
+			rejections = append(rejections, Rejection{Index: i, Reason: WrongDimension})
+		} else if !isFinite(p.Vector()) {
+			rejections = append(rejections, Rejection{Index: i, Reason: NonFiniteCoordinate})
+		} else {
+			accepted = append(accepted, p)
+		}
+	}
+	if options.Report != nil {
+		*options.Report = ConstructReport{Accepted: len(accepted), Rejections: rejections}
+	}
+	if options.Strict && len(rejections) > 0 {
+		return nil, &RejectedPointsError{Rejections: rejections}
+	}
+	return accepted, nil
+}
+
+func isFinite(vector PointVector) bool {
+	for _, v := range vector {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -48,3 +48,42 @@ func Difference(vec1, vec2 PointVector) (PointVector, error) {
 	}
 	return result, nil
 }
+
+/**
+* Returns the smallest L2 distance from vec to any point of the box [min, max].
+* The box may be unbounded along any axis.
+ */
+func MinDistanceToBox(vec, min, max PointVector) float64 {
+	distance := 0.
+	for i, v := range vec {
+		if v < min[i] {
+			distance += (min[i] - v) * (min[i] - v)
+		} else if v > max[i] {
+			distance += (v - max[i]) * (v - max[i])
+		}
+	}
+	return math.Sqrt(distance)
+}
+
+/**
+* Returns the largest L2 distance from vec to any point of the box [min, max]
+ */
+func MaxDistanceToBox(vec, min, max PointVector) float64 {
+	distance := 0.
+	for i, v := range vec {
+		d := math.Max(math.Abs(v-min[i]), math.Abs(max[i]-v))
+		distance += d * d
+	}
+	return math.Sqrt(distance)
+}
+
+/**
+* Returns the L2 norm of a vector
+ */
+func Norm(vec PointVector) float64 {
+	norm := 0.
+	for _, v := range vec {
+		norm += v * v
+	}
+	return math.Sqrt(norm)
+}
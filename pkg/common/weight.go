@@ -0,0 +1,16 @@
+package common
+
+// WeightedPoint is a point standing for several observations, such as a population or a
+// sample weight. Weighted algorithms count it Weight() times, and every other point once.
+type WeightedPoint interface {
+	Point
+	Weight() float64
+}
+
+// Returns the weight of a WeightedPoint, and one for any other point
+func Weight(p Point) float64 {
+	if weighted, ok := p.(WeightedPoint); ok {
+		return weighted.Weight()
+	}
+	return 1
+}
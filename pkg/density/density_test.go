@@ -0,0 +1,268 @@
+package density_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	balltree "github.com/KrishanBhalla/space-partitioning-trees/pkg/ball_tree"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/density"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPoint struct {
+	dimension int
+	vector    common.PointVector
+}
+
+func (t *testPoint) Dimension() int {
+	return t.dimension
+}
+
+func (t *testPoint) Vector() common.PointVector {
+	return t.vector
+}
+
+func createPoint(dimension int, lowerBound, upperBound float64) common.Point {
+	vector := make([]float64, dimension)
+	for i := range vector {
+		vector[i] = lowerBound + rand.Float64()*(upperBound-lowerBound)
+	}
+	return &testPoint{dimension: dimension, vector: vector}
+}
+
+func createPoints(nPoints, dimension int, lowerBound, upperBound float64) []common.Point {
+	result := make([]common.Point, nPoints)
+	for i := range result {
+		result[i] = createPoint(dimension, lowerBound, upperBound)
+	}
+	return result
+}
+
+var kernels = []density.Kernel{density.Gaussian, density.Epanechnikov, density.Tophat, density.Exponential, density.Linear}
+
+func unnormalisedKernel(kernel density.Kernel, d, h float64) float64 {
+	switch kernel {
+	case density.Gaussian:
+		return math.Exp(-d * d / (2 * h * h))
+	case density.Epanechnikov:
+		return math.Max(0, 1-d*d/(h*h))
+	case density.Tophat:
+		if d < h {
+			return 1
+		}
+		return 0
+	case density.Exponential:
+		return math.Exp(-d / h)
+	}
+	return math.Max(0, 1-d/h)
+}
+
+// Every kernel is one at distance zero, so the density of a single point at itself is the
+// normalisation constant
+func kernelNormalisation(t *testing.T, kernel density.Kernel, dimension int, h float64) float64 {
+	p := createPoint(dimension, 0, 1)
+	tree := balltree.BallTree{}
+	tree.Construct([]common.Point{p}, dimension)
+	kde := density.KernelDensity{Kernel: kernel, Bandwidth: h}
+	assert.Nil(t, kde.Fit(&tree))
+	norm, err := kde.Density(p)
+	assert.Nil(t, err)
+	return norm
+}
+
+func bruteForceDensity(kernel density.Kernel, h, norm float64, q common.Point, points []common.Point, weights map[common.Point]float64) float64 {
+	sum, total := 0., 0.
+	for _, p := range points {
+		w := 1.
+		if weights != nil {
+			w = weights[p]
+		}
+		d, _ := common.Distance(q.Vector(), p.Vector())
+		sum += w * unnormalisedKernel(kernel, d, h)
+		total += w
+	}
+	return norm * sum / total
+}
+
+func TestKernelsIntegrateToOne(t *testing.T) {
+	origin := &testPoint{dimension: 1, vector: common.PointVector{0}}
+	tree := balltree.BallTree{}
+	tree.Construct([]common.Point{origin}, 1)
+	for _, kernel := range kernels {
+		kde := density.KernelDensity{Kernel: kernel, Bandwidth: 0.5}
+		assert.Nil(t, kde.Fit(&tree))
+		integral, step := 0., 0.001
+		for x := -20 + step/2; x < 20; x += step {
+			d, err := kde.Density(&testPoint{dimension: 1, vector: common.PointVector{x}})
+			assert.Nil(t, err)
+			integral += d * step
+		}
+		assert.InDelta(t, 1, integral, 1e-3, kernel.String())
+	}
+
+	origin = &testPoint{dimension: 2, vector: common.PointVector{0, 0}}
+	tree = balltree.BallTree{}
+	tree.Construct([]common.Point{origin}, 2)
+	for _, kernel := range kernels {
+		kde := density.KernelDensity{Kernel: kernel, Bandwidth: 1}
+		assert.Nil(t, kde.Fit(&tree))
+		integral, step := 0., 0.05
+		for x := -15 + step/2; x < 15; x += step {
+			for y := -15 + step/2; y < 15; y += step {
+				d, err := kde.Density(&testPoint{dimension: 2, vector: common.PointVector{x, y}})
+				assert.Nil(t, err)
+				integral += d * step * step
+			}
+		}
+		assert.InDelta(t, 1, integral, 1e-2, kernel.String())
+	}
+}
+
+func TestExactDensity(t *testing.T) {
+	dimension := 3
+	h := 0.2
+	points := createPoints(2000, dimension, 0, 1)
+	weights := map[common.Point]float64{}
+	for _, p := range points {
+		weights[p] = rand.Float64() * 3
+	}
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	queries := createPoints(50, dimension, -0.2, 1.2)
+
+	for _, kernel := range kernels {
+		norm := kernelNormalisation(t, kernel, dimension, h)
+		for _, weighted := range []bool{false, true} {
+			kde := density.KernelDensity{Kernel: kernel, Bandwidth: h}
+			var w map[common.Point]float64
+			if weighted {
+				w = weights
+				kde.Weight = func(p common.Point) float64 { return weights[p] }
+			}
+			assert.Nil(t, kde.Fit(&tree))
+			logDensities, err := kde.LogDensities(queries)
+			assert.Nil(t, err)
+			for i, q := range queries {
+				expected := bruteForceDensity(kernel, h, norm, q, points, w)
+				if expected == 0 {
+					assert.True(t, math.IsInf(logDensities[i], -1))
+				} else {
+					assert.InDelta(t, math.Log(expected), logDensities[i], 1e-9, kernel.String())
+				}
+			}
+		}
+	}
+}
+
+func TestApproximateDensity(t *testing.T) {
+	dimension := 2
+	h := 0.05
+	points := createPoints(20000, dimension, 0, 1)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	queries := createPoints(100, dimension, 0, 1)
+
+	for _, kernel := range kernels {
+		norm := kernelNormalisation(t, kernel, dimension, h)
+		for _, tolerance := range [][2]float64{{1e-2, 0}, {0, 1e-3}, {1e-3, 1e-2}} {
+			kde := density.KernelDensity{Kernel: kernel, Bandwidth: h, AbsoluteTolerance: tolerance[0], RelativeTolerance: tolerance[1]}
+			assert.Nil(t, kde.Fit(&tree))
+			for _, q := range queries {
+				expected := bruteForceDensity(kernel, h, norm, q, points, nil)
+				actual, err := kde.Density(q)
+				assert.Nil(t, err)
+				assert.LessOrEqual(t, math.Abs(actual-expected), tolerance[0]+tolerance[1]*expected+1e-9, kernel.String())
+			}
+		}
+	}
+}
+
+func TestDensityErrors(t *testing.T) {
+	points := createPoints(100, 2, 0, 1)
+	tree := balltree.BallTree{}
+	tree.Construct(points, 2)
+
+	kde := density.KernelDensity{Kernel: density.Gaussian, Bandwidth: 1}
+	_, err := kde.LogDensity(points[0])
+	assert.NotNil(t, err)
+
+	assert.NotNil(t, (&density.KernelDensity{Kernel: density.Gaussian}).Fit(&tree))
+	assert.NotNil(t, (&density.KernelDensity{Kernel: density.Gaussian, Bandwidth: 1, RelativeTolerance: -1}).Fit(&tree))
+	assert.NotNil(t, (&density.KernelDensity{Kernel: density.Kernel(10), Bandwidth: 1}).Fit(&tree))
+	assert.NotNil(t, (&density.KernelDensity{Kernel: density.Gaussian, Bandwidth: 1, Weight: func(common.Point) float64 { return -1 }}).Fit(&tree))
+	assert.NotNil(t, kde.Fit(&balltree.BallTree{Dimension: 2}))
+
+	assert.Nil(t, kde.Fit(&tree))
+	_, err = kde.Density(createPoint(3, 0, 1))
+	assert.NotNil(t, err)
+}
+
+type weightedTestPoint struct {
+	testPoint
+	weight float64
+}
+
+func (t *weightedTestPoint) Weight() float64 {
+	return t.weight
+}
+
+func TestWeightedPointsDensity(t *testing.T) {
+	dimension := 2
+	h := 0.2
+	points := make([]common.Point, 1000)
+	weights := map[common.Point]float64{}
+	for i := range points {
+		p := &weightedTestPoint{testPoint: *createPoint(dimension, 0, 1).(*testPoint), weight: rand.Float64() * 3}
+		points[i] = p
+		weights[p] = p.weight
+	}
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	queries := createPoints(20, dimension, -0.2, 1.2)
+	for _, kernel := range kernels {
+		norm := kernelNormalisation(t, kernel, dimension, h)
+		kde := density.KernelDensity{Kernel: kernel, Bandwidth: h}
+		assert.Nil(t, kde.Fit(&tree))
+		for _, q := range queries {
+			d, err := kde.Density(q)
+			assert.Nil(t, err)
+			assert.InDelta(t, bruteForceDensity(kernel, h, norm, q, points, weights), d, 1e-9, kernel.String())
+		}
+	}
+}
+
+func TestLogDensityFarFromThePoints(t *testing.T) {
+	dimension := 2
+	h := 0.1
+	points := createPoints(500, dimension, 0, 1)
+	tree := balltree.BallTree{}
+	tree.Construct(points, dimension)
+	query := &testPoint{dimension: dimension, vector: common.PointVector{50, 50}}
+	// The log of the Gaussian density, summed in log space, far beyond where it underflows
+	logKernels := common.Map(points, func(p common.Point) float64 {
+		d, _ := common.Distance(query.Vector(), p.Vector())
+		return -d * d / (2 * h * h)
+	})
+	largest := math.Inf(-1)
+	for _, l := range logKernels {
+		largest = math.Max(largest, l)
+	}
+	sum := 0.
+	for _, l := range logKernels {
+		sum += math.Exp(l - largest)
+	}
+	expected := largest + math.Log(sum) - math.Log(2*math.Pi) - 2*math.Log(h) - math.Log(float64(len(points)))
+
+	for _, rtol := range []float64{0, 0.01} {
+		kde := density.KernelDensity{Kernel: density.Gaussian, Bandwidth: h, RelativeTolerance: rtol}
+		assert.Nil(t, kde.Fit(&tree))
+		logDensity, err := kde.LogDensity(query)
+		assert.Nil(t, err)
+		assert.False(t, math.IsInf(logDensity, 0), "Expecting a finite log density far from the points")
+		assert.InDelta(t, expected, logDensity, math.Log1p(rtol)+1e-9*math.Abs(expected))
+		density, _ := kde.Density(query)
+		assert.Equal(t, 0., density, "Expecting the density itself to underflow")
+	}
+}
@@ -0,0 +1,85 @@
+package density
+
+import "math"
+
+type Kernel int
+
+const (
+	Gaussian Kernel = iota
+	Epanechnikov
+	Tophat
+	Exponential
+	Linear
+)
+
+func (k Kernel) String() string {
+	switch k {
+	case Gaussian:
+		return "gaussian"
+	case Epanechnikov:
+		return "epanechnikov"
+	case Tophat:
+		return "tophat"
+	case Exponential:
+		return "exponential"
+	case Linear:
+		return "linear"
+	}
+	return "unknown"
+}
+
+// The unnormalised kernel at distance d, which is non-increasing in d
+func (k Kernel) evaluate(d, bandwidth float64) float64 {
+	switch k {
+	case Gaussian:
+		return math.Exp(-0.5 * d * d / (bandwidth * bandwidth))
+	case Epanechnikov:
+		return math.Max(0, 1-d*d/(bandwidth*bandwidth))
+	case Tophat:
+		if d < bandwidth {
+			return 1
+		}
+		return 0
+	case Exponential:
+		return math.Exp(-d / bandwidth)
+	case Linear:
+		return math.Max(0, 1-d/bandwidth)
+	}
+	return math.NaN()
+}
+
+// The log of the unnormalised kernel at distance d, computed directly where the kernel itself
+// would underflow
+func (k Kernel) logEvaluate(d, bandwidth float64) float64 {
+	switch k {
+	case Gaussian:
+		return -0.5 * d * d / (bandwidth * bandwidth)
+	case Exponential:
+		return -d / bandwidth
+	}
+	return math.Log(k.evaluate(d, bandwidth))
+}
+
+// Log of the constant which makes the kernel integrate to one over a space of the given dimension
+func (k Kernel) logNormalisation(dimension int, bandwidth float64) float64 {
+	d := float64(dimension)
+	lgammaHalf, _ := math.Lgamma(d/2 + 1)
+	// Volume of the unit ball, and surface area of the unit sphere, in d dimensions
+	logUnitVolume := d/2*math.Log(math.Pi) - lgammaHalf
+	logUnitSurface := logUnitVolume + math.Log(d)
+	var factor float64
+	switch k {
+	case Gaussian:
+		factor = -d / 2 * math.Log(2*math.Pi)
+	case Epanechnikov:
+		factor = math.Log((d+2)/2) - logUnitVolume
+	case Tophat:
+		factor = -logUnitVolume
+	case Exponential:
+		lgamma, _ := math.Lgamma(d)
+		factor = -logUnitSurface - lgamma
+	case Linear:
+		factor = math.Log(d*(d+1)) - logUnitSurface
+	}
+	return factor - d*math.Log(bandwidth)
+}
@@ -0,0 +1,175 @@
+package density
+
+import (
+	"fmt"
+	"math"
+
+	balltree "github.com/KrishanBhalla/space-partitioning-trees/pkg/ball_tree"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// KernelDensity estimates the density of the points of a BallTree at query points. Whole
+// subtrees whose kernel values vary by less than the tolerances allow are approximated from
+// the bounds of their ball, so that each density is within
+// AbsoluteTolerance + RelativeTolerance * density of the exact value. With both tolerances
+// zero the result is exact.
+type KernelDensity struct {
+	Kernel            Kernel
+	Bandwidth         float64
+	AbsoluteTolerance float64
+	RelativeTolerance float64
+	// The weight of each point, which must be non-negative. Defaults to common.Weight, so that
+	// WeightedPoints count by their weight and other points once.
+	Weight func(common.Point) float64
+
+	root             *node
+	dimension        int
+	logTotalWeight   float64
+	logNormalisation float64
+}
+
+// A ball of the tree, with the total weight of the points inside it
+type node struct {
+	centre      common.PointVector
+	radius      float64
+	pivot       common.PointVector
+	pivotWeight float64
+	weight      float64
+	left        *node
+	right       *node
+}
+
+// Prepares the estimator for the points of the tree. The tree must not change afterwards.
+func (kde *KernelDensity) Fit(tree *balltree.BallTree) error {
+	if !(kde.Bandwidth > 0) {
+		return fmt.Errorf("The bandwidth must be positive, found %v", kde.Bandwidth)
+	}
+	if kde.AbsoluteTolerance < 0 || kde.RelativeTolerance < 0 {
+		return fmt.Errorf("The tolerances must be non-negative, found %v and %v", kde.AbsoluteTolerance, kde.RelativeTolerance)
+	}
+	if kde.Kernel < Gaussian || kde.Kernel > Linear {
+		return fmt.Errorf("Unknown kernel %d", kde.Kernel)
+	}
+	root, err := kde.build(tree)
+	if err != nil {
+		return err
+	}
+	if root == nil || root.weight == 0 {
+		return fmt.Errorf("The tree must hold points of positive total weight")
+	}
+	kde.root = root
+	kde.dimension = tree.Dimension
+	kde.logTotalWeight = math.Log(root.weight)
+	kde.logNormalisation = kde.Kernel.logNormalisation(tree.Dimension, kde.Bandwidth)
+	return nil
+}
+
+func (kde *KernelDensity) build(tree *balltree.BallTree) (*node, error) {
+	if tree == nil || tree.Root == nil {
+		return nil, nil
+	}
+	weight := common.Weight(tree.Root.Data)
+	if kde.Weight != nil {
+		weight = kde.Weight(tree.Root.Data)
+	}
+	if !(weight >= 0) || math.IsInf(weight, 1) {
+		return nil, fmt.Errorf("Point weights must be finite and non-negative, found %v", weight)
+	}
+	result := &node{
+		centre:      tree.Root.Centroid,
+		radius:      tree.Root.Radius,
+		pivot:       tree.Root.Data.Vector(),
+		pivotWeight: weight,
+		weight:      weight,
+	}
+	var err error
+	if result.left, err = kde.build(tree.Left); err != nil {
+		return nil, err
+	}
+	if result.right, err = kde.build(tree.Right); err != nil {
+		return nil, err
+	}
+	for _, child := range []*node{result.left, result.right} {
+		if child != nil {
+			result.weight += child.weight
+		}
+	}
+	return result, nil
+}
+
+// Returns the estimated density at the query point
+func (kde *KernelDensity) Density(point common.Point) (float64, error) {
+	logDensity, err := kde.LogDensity(point)
+	if err != nil {
+		return 0, err
+	}
+	return math.Exp(logDensity), nil
+}
+
+// Returns the log of the estimated density at the query point, which stays accurate where the
+// density itself would underflow. Points outside the support of the kernel give -Inf.
+func (kde *KernelDensity) LogDensity(point common.Point) (float64, error) {
+	if kde.root == nil {
+		return 0, fmt.Errorf("The estimator must be fitted before use")
+	}
+	if err := common.CheckDimension("query point", point.Dimension(), kde.dimension); err != nil {
+		return 0, err
+	}
+	vector := point.Vector()
+	// Convert the tolerances to the scale of the unnormalised kernel, spreading the absolute
+	// tolerance across nodes in proportion to their weight
+	logAtol := math.Log(kde.AbsoluteTolerance) - kde.logNormalisation
+	logSum := kde.evaluate(kde.root, vector, logAtol)
+	return logSum + kde.logNormalisation - kde.logTotalWeight, nil
+}
+
+// Returns the log density at each of the query points
+func (kde *KernelDensity) LogDensities(points []common.Point) ([]float64, error) {
+	result := make([]float64, len(points))
+	for i, p := range points {
+		logDensity, err := kde.LogDensity(p)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = logDensity
+	}
+	return result, nil
+}
+
+// The log of the weighted sum of unnormalised kernel values over the points of a node. Sums
+// are taken in log space, so that distant nodes still count where their kernel values would
+// underflow.
+func (kde *KernelDensity) evaluate(n *node, vector common.PointVector, logAtol float64) float64 {
+	d, _ := common.Distance(vector, n.centre)
+	logUpper := kde.Kernel.logEvaluate(math.Max(0, d-n.radius), kde.Bandwidth)
+	if math.IsInf(logUpper, -1) {
+		return logUpper
+	}
+	logLower := kde.Kernel.logEvaluate(d+n.radius, kde.Bandwidth)
+	// Approximate the node by the midpoint of its bounds if (upper - lower) / 2 is within
+	// atol + rtol * lower
+	logHalfGap := logUpper + math.Log1p(-math.Exp(logLower-logUpper)) - math.Ln2
+	if logHalfGap <= logAddExp(logAtol, math.Log(kde.RelativeTolerance)+logLower) {
+		return math.Log(n.weight) + logAddExp(logUpper, logLower) - math.Ln2
+	}
+	pivotDistance, _ := common.Distance(vector, n.pivot)
+	logSum := math.Log(n.pivotWeight) + kde.Kernel.logEvaluate(pivotDistance, kde.Bandwidth)
+	if n.left != nil {
+		logSum = logAddExp(logSum, kde.evaluate(n.left, vector, logAtol))
+	}
+	if n.right != nil {
+		logSum = logAddExp(logSum, kde.evaluate(n.right, vector, logAtol))
+	}
+	return logSum
+}
+
+// Returns log(exp(a) + exp(b)) without overflow or underflow
+func logAddExp(a, b float64) float64 {
+	if a < b {
+		a, b = b, a
+	}
+	if math.IsInf(b, -1) {
+		return a
+	}
+	return a + math.Log1p(math.Exp(b-a))
+}
@@ -0,0 +1,125 @@
+package dualtree
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Finds the k closest pairs made of one point from each tree, closest first
+func ClosestPairs(a, b common.Subtree, k int) ([]common.PointPair, error) {
+	if err := common.CheckDimension("second tree", b.NodeDimension(), a.NodeDimension()); err != nil {
+		return nil, err
+	}
+	return closestPairs(a, b, k, false)
+}
+
+// Finds the k closest pairs of distinct points of a tree, closest first. Each pair is reported once.
+func ClosestPairsSelf(tree common.Subtree, k int) ([]common.PointPair, error) {
+	return closestPairs(tree, tree, k, true)
+}
+
+func closestPairs(a, b common.Subtree, k int, self bool) ([]common.PointPair, error) {
+	if err := common.CheckK(k); err != nil {
+		return nil, err
+	}
+	queries := newMirror(a)
+	references := queries
+	if !self {
+		references = newMirror(b)
+	}
+	rules := &closestPairRules{queries: queries, references: references, k: k, self: self}
+	if queries.root != nil && references.root != nil {
+		traverse(queries.root, references.root, rules)
+	}
+	pairs := append(pairHeap{}, rules.pairs...)
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].before(pairs[j]) })
+	result := make([]common.PointPair, len(pairs))
+	for i, p := range pairs {
+		result[i] = common.PointPair{A: queries.points[p.a], B: references.points[p.b], Distance: p.distance}
+	}
+	return result, nil
+}
+
+type pair struct {
+	a        int
+	b        int
+	distance float64
+}
+
+// Ties on distance are broken by index, so that results do not depend on visiting order
+func (p pair) before(other pair) bool {
+	if p.distance != other.distance {
+		return p.distance < other.distance
+	}
+	if p.a != other.a {
+		return p.a < other.a
+	}
+	return p.b < other.b
+}
+
+// A max-heap of the best pairs found so far, worst first
+type pairHeap []pair
+
+func (h pairHeap) Len() int {
+	return len(h)
+}
+
+func (h pairHeap) Less(i, j int) bool {
+	return h[j].before(h[i])
+}
+
+func (h pairHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *pairHeap) Push(x interface{}) {
+	*h = append(*h, x.(pair))
+}
+
+func (h *pairHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+type closestPairRules struct {
+	queries    *mirror
+	references *mirror
+	k          int
+	self       bool
+	pairs      pairHeap
+}
+
+func (rules *closestPairRules) score(q, r *node) (float64, bool) {
+	// Within one tree only pairs with a < b are counted, so skip node pairs holding none
+	if rules.self && q.first >= r.last {
+		return 0, false
+	}
+	d := q.bounds.MinDistanceTo(r.bounds)
+	return d, len(rules.pairs) < rules.k || d <= rules.pairs[0].distance
+}
+
+func (rules *closestPairRules) base(q, r *node) {
+	for i := q.first; i <= q.last; i++ {
+		start := r.first
+		if rules.self && start <= i {
+			start = i + 1
+		}
+		for j := start; j <= r.last; j++ {
+			d, _ := common.Distance(rules.queries.vectors[i], rules.references.vectors[j])
+			candidate := pair{a: i, b: j, distance: d}
+			if len(rules.pairs) < rules.k {
+				heap.Push(&rules.pairs, candidate)
+			} else if candidate.before(rules.pairs[0]) {
+				rules.pairs[0] = candidate
+				heap.Fix(&rules.pairs, 0)
+			}
+		}
+	}
+}
+
+func (rules *closestPairRules) update(q *node) {}
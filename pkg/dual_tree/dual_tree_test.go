@@ -0,0 +1,329 @@
+package dualtree_test
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	balltree "github.com/KrishanBhalla/space-partitioning-trees/pkg/ball_tree"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	dualtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/dual_tree"
+	kdtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/kd_tree"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPoint struct {
+	dimension int
+	vector    common.PointVector
+}
+
+func (t *testPoint) Dimension() int {
+	return t.dimension
+}
+
+func (t *testPoint) Vector() common.PointVector {
+	return t.vector
+}
+
+func createPoint(dimension int, lowerBound, upperBound float64) common.Point {
+	vector := make([]float64, dimension)
+	for i := range vector {
+		vector[i] = lowerBound + rand.Float64()*(upperBound-lowerBound)
+	}
+	return &testPoint{dimension: dimension, vector: vector}
+}
+
+func createPoints(nPoints, dimension int, lowerBound, upperBound float64) []common.Point {
+	result := make([]common.Point, nPoints)
+	for i := range result {
+		result[i] = createPoint(dimension, lowerBound, upperBound)
+	}
+	return result
+}
+
+// Builds a KdTree and a BallTree over the same points
+func createTrees(points []common.Point, dimension int) map[string]common.Subtree {
+	kd := kdtree.KdTree{}
+	kd.Construct(points, dimension)
+	ball := balltree.BallTree{}
+	ball.Construct(points, dimension)
+	return map[string]common.Subtree{"kd": &kd, "ball": &ball}
+}
+
+// Sorted distances from p to every candidate other than p itself
+func bruteForceDistances(p common.Point, candidates []common.Point) []float64 {
+	distances := []float64{}
+	for _, c := range candidates {
+		if c != p {
+			d, _ := common.Distance(p.Vector(), c.Vector())
+			distances = append(distances, d)
+		}
+	}
+	sort.Float64s(distances)
+	return distances
+}
+
+func neighbourDistances(neighbours []common.PointWithDistance) []float64 {
+	return common.Map(neighbours, func(n common.PointWithDistance) float64 { return n.Distance })
+}
+
+func TestCanFindAllNearestNeighboursAcrossTrees(t *testing.T) {
+	dimension := 3
+	k := 4
+	queryPoints := createPoints(500, dimension, -100, 100)
+	referencePoints := createPoints(800, dimension, -100, 100)
+	queryTrees := createTrees(queryPoints, dimension)
+	referenceTrees := createTrees(referencePoints, dimension)
+	for queryName, query := range queryTrees {
+		for referenceName, reference := range referenceTrees {
+			result, err := dualtree.AllKNearestNeighbors(query, reference, k)
+			assert.Nil(t, err, "No error should be returned")
+			assert.Len(t, result, len(queryPoints), "Expecting a result for every query point")
+			for _, r := range result {
+				expected := bruteForceDistances(r.Point, referencePoints)[:k]
+				assert.Equal(t, expected, neighbourDistances(r.Neighbors), "Expecting %s against %s to match a brute force scan", queryName, referenceName)
+			}
+		}
+	}
+}
+
+func TestCanFindAllNearestNeighboursWithinATree(t *testing.T) {
+	dimension := 3
+	k := 5
+	points := createPoints(1000, dimension, -100, 100)
+	for name, tree := range createTrees(points, dimension) {
+		result, err := dualtree.AllKNearestNeighborsSelf(tree, k)
+		assert.Nil(t, err, "No error should be returned")
+		assert.Len(t, result, len(points), "Expecting a result for every point")
+		for _, r := range result {
+			expected := bruteForceDistances(r.Point, points)[:k]
+			assert.Equal(t, expected, neighbourDistances(r.Neighbors), "Expecting the %s tree to match a brute force scan", name)
+			for _, n := range r.Neighbors {
+				assert.NotSame(t, r.Point, n.Point, "Expecting a point not to be its own neighbour")
+			}
+		}
+	}
+}
+
+func TestAllNearestNeighboursRejectsMismatchedTrees(t *testing.T) {
+	a := createTrees(createPoints(10, 2, -1, 1), 2)["kd"]
+	b := createTrees(createPoints(10, 3, -1, 1), 3)["ball"]
+	_, err := dualtree.AllKNearestNeighbors(a, b, 1)
+	assert.NotNil(t, err, "Expecting an error for trees of differing dimension")
+	_, err = dualtree.AllKNearestNeighborsSelf(a, 0)
+	assert.NotNil(t, err, "Expecting an error for non-positive k")
+}
+
+func hasEdge(g *dualtree.Graph, i, j int) bool {
+	indices, _ := g.Neighbors(i)
+	for _, index := range indices {
+		if index == j {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCanBuildNearestNeighbourGraph(t *testing.T) {
+	dimension := 3
+	k := 6
+	points := createPoints(1000, dimension, -100, 100)
+	for name, tree := range createTrees(points, dimension) {
+		graph, err := dualtree.KNearestNeighborGraph(tree, k, dualtree.GraphOptions{Workers: 4})
+		assert.Nil(t, err, "No error should be returned")
+		assert.Len(t, graph.Points, len(points), "Expecting a vertex for every point")
+		assert.Len(t, graph.Indices, k*len(points), "Expecting k edges per vertex")
+		for i, p := range graph.Points {
+			indices, distances := graph.Neighbors(i)
+			assert.Equal(t, bruteForceDistances(p, points)[:k], distances, "Expecting the %s graph to match a brute force scan", name)
+			assert.NotContains(t, indices, i, "Expecting no self loops")
+		}
+
+		union, err := dualtree.KNearestNeighborGraph(tree, k, dualtree.GraphOptions{Symmetrization: dualtree.UnionSymmetrization})
+		assert.Nil(t, err, "No error should be returned")
+		mutual, err := dualtree.KNearestNeighborGraph(tree, k, dualtree.GraphOptions{Symmetrization: dualtree.MutualSymmetrization})
+		assert.Nil(t, err, "No error should be returned")
+		for i := range graph.Points {
+			indices, _ := graph.Neighbors(i)
+			for _, j := range indices {
+				assert.True(t, hasEdge(union, i, j) && hasEdge(union, j, i), "Expecting the union graph to hold every edge both ways")
+				assert.Equal(t, hasEdge(graph, j, i), hasEdge(mutual, i, j), "Expecting the mutual graph to hold only reciprocated edges")
+			}
+			indices, _ = mutual.Neighbors(i)
+			for _, j := range indices {
+				assert.True(t, hasEdge(mutual, j, i), "Expecting the mutual graph to be symmetric")
+			}
+		}
+	}
+}
+
+func TestNearestNeighbourGraphBreaksTiesDeterministically(t *testing.T) {
+	dimension := 2
+	// A lattice has many neighbours at exactly equal distances
+	points := []common.Point{}
+	for x := 0; x < 20; x++ {
+		for y := 0; y < 20; y++ {
+			points = append(points, &testPoint{dimension: dimension, vector: common.PointVector{float64(x), float64(y)}})
+		}
+	}
+	for name, tree := range createTrees(points, dimension) {
+		sequential, err := dualtree.KNearestNeighborGraph(tree, 3, dualtree.GraphOptions{Workers: 1})
+		assert.Nil(t, err, "No error should be returned")
+		parallel, err := dualtree.KNearestNeighborGraph(tree, 3, dualtree.GraphOptions{Workers: 8})
+		assert.Nil(t, err, "No error should be returned")
+		assert.Equal(t, sequential.Indices, parallel.Indices, "Expecting the %s graph not to depend on the number of workers", name)
+		for i := range sequential.Points {
+			indices, distances := sequential.Neighbors(i)
+			for j := 1; j < len(indices); j++ {
+				assert.True(t, distances[j-1] < distances[j] || indices[j-1] < indices[j], "Expecting ties to be ordered by index")
+			}
+		}
+	}
+}
+
+func TestCanJoinTreesWithinDistance(t *testing.T) {
+	dimension := 3
+	radius := 15.
+	aPoints := createPoints(600, dimension, -100, 100)
+	bPoints := createPoints(400, dimension, -100, 100)
+	expected := map[[2]common.Point]bool{}
+	for _, a := range aPoints {
+		for _, b := range bPoints {
+			if d, _ := common.Distance(a.Vector(), b.Vector()); d < radius {
+				expected[[2]common.Point{a, b}] = true
+			}
+		}
+	}
+	assert.NotEmpty(t, expected, "Expecting the test data to hold some close pairs")
+	for aName, a := range createTrees(aPoints, dimension) {
+		for bName, b := range createTrees(bPoints, dimension) {
+			result := map[[2]common.Point]bool{}
+			err := dualtree.RangeJoin(a, b, radius, func(a, b common.Point, distance float64) bool {
+				result[[2]common.Point{a, b}] = true
+				return true
+			})
+			assert.Nil(t, err, "No error should be returned")
+			assert.Equal(t, expected, result, "Expecting the join of %s and %s to match a brute force scan", aName, bName)
+		}
+	}
+}
+
+func TestRangeJoinStopsWhenAsked(t *testing.T) {
+	dimension := 3
+	trees := createTrees(createPoints(500, dimension, -100, 100), dimension)
+	calls := 0
+	err := dualtree.RangeJoin(trees["kd"], trees["ball"], 1000, func(a, b common.Point, distance float64) bool {
+		calls++
+		return calls < 10
+	})
+	assert.Nil(t, err, "No error should be returned")
+	assert.Equal(t, 10, calls, "Expecting the join to stop once the callback returns false")
+}
+
+// Total weight of the minimum spanning tree of the complete graph, by Prim's algorithm
+func bruteForceSpanningTreeWeight(points []common.Point, weight func(a, b common.Point) float64) float64 {
+	inTree := make([]bool, len(points))
+	best := make([]float64, len(points))
+	for i := range best {
+		best[i] = math.Inf(1)
+	}
+	best[0] = 0
+	total := 0.
+	for range points {
+		next := -1
+		for i := range points {
+			if !inTree[i] && (next < 0 || best[i] < best[next]) {
+				next = i
+			}
+		}
+		inTree[next] = true
+		total += best[next]
+		for i, p := range points {
+			if !inTree[i] {
+				best[i] = math.Min(best[i], weight(points[next], p))
+			}
+		}
+	}
+	return total
+}
+
+// Checks that the edges connect every point of the spanning tree, returning their total weight
+func spanningTreeWeight(t *testing.T, tree *dualtree.SpanningTree) float64 {
+	assert.Len(t, tree.Edges, len(tree.Points)-1, "Expecting a spanning tree to have one edge fewer than it has points")
+	component := make([]int, len(tree.Points))
+	for i := range component {
+		component[i] = i
+	}
+	total := 0.
+	for i, e := range tree.Edges {
+		if i > 0 {
+			assert.LessOrEqual(t, tree.Edges[i-1].Weight, e.Weight, "Expecting the edges to be sorted by weight")
+		}
+		total += e.Weight
+		from, to := component[e.A], component[e.B]
+		assert.NotEqual(t, from, to, "Expecting the edges not to form a cycle")
+		for j := range component {
+			if component[j] == from {
+				component[j] = to
+			}
+		}
+	}
+	return total
+}
+
+func TestCanBuildMutualReachabilitySpanningTree(t *testing.T) {
+	dimension := 3
+	points := createPoints(800, dimension, -100, 100)
+	core := map[common.Point]float64{}
+	for _, p := range points {
+		core[p] = rand.Float64() * 20
+	}
+	mutualReachability := func(a, b common.Point) float64 {
+		d, _ := common.Distance(a.Vector(), b.Vector())
+		return math.Max(d, math.Max(core[a], core[b]))
+	}
+	expected := bruteForceSpanningTreeWeight(points, mutualReachability)
+	for name, tree := range createTrees(points, dimension) {
+		result, err := dualtree.MutualReachabilitySpanningTree(tree, func(p common.Point) float64 { return core[p] })
+		assert.Nil(t, err, "No error should be returned")
+		for _, e := range result.Edges {
+			assert.Equal(t, mutualReachability(result.Points[e.A], result.Points[e.B]), e.Weight, "Expecting edge weights to be mutual reachability distances")
+		}
+		assert.InDelta(t, expected, spanningTreeWeight(t, result), 1e-6, "Expecting the %s spanning tree to have minimum weight", name)
+	}
+
+	_, err := dualtree.MutualReachabilitySpanningTree(createTrees(points, dimension)["kd"], func(common.Point) float64 { return -1 })
+	assert.NotNil(t, err, "Expecting negative core distances to be rejected")
+}
+
+func TestCanBuildEuclideanMinimumSpanningTree(t *testing.T) {
+	dimension := 3
+	points := createPoints(1000, dimension, -100, 100)
+	// Repeated points are joined by edges of zero weight
+	points = append(points, &testPoint{dimension: dimension, vector: points[0].Vector()})
+	distance := func(a, b common.Point) float64 {
+		d, _ := common.Distance(a.Vector(), b.Vector())
+		return d
+	}
+	expected := bruteForceSpanningTreeWeight(points, distance)
+	for name, tree := range createTrees(points, dimension) {
+		result, err := dualtree.MinimumSpanningTree(tree)
+		assert.Nil(t, err, "No error should be returned")
+		assert.ElementsMatch(t, points, result.Points, "Expecting the spanning tree to hold every point")
+		assert.Equal(t, 0., result.Edges[0].Weight, "Expecting the repeated point to be joined first")
+		for _, e := range result.Edges {
+			assert.Equal(t, distance(result.Points[e.A], result.Points[e.B]), e.Weight, "Expecting edge weights to be distances")
+		}
+		assert.InDelta(t, expected, spanningTreeWeight(t, result), 1e-6, "Expecting the %s spanning tree to have minimum weight", name)
+	}
+
+	for name, tree := range createTrees(points[:1], dimension) {
+		result, err := dualtree.MinimumSpanningTree(tree)
+		assert.Nil(t, err, "No error should be returned")
+		assert.Empty(t, result.Edges, "Expecting a single %s point to need no edges", name)
+	}
+	result, err := dualtree.MinimumSpanningTree(&kdtree.KdTree{Dimension: dimension})
+	assert.Nil(t, err, "No error should be returned")
+	assert.Empty(t, result.Points, "Expecting an empty tree to give an empty spanning tree")
+}
@@ -0,0 +1,109 @@
+package dualtree
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Graph is a sparse weighted adjacency in compressed sparse row form. The edges leaving
+// vertex i go to Indices[Offsets[i]:Offsets[i+1]], with the matching Distances, and vertex i
+// stands for Points[i].
+type Graph struct {
+	Points    []common.Point
+	Offsets   []int
+	Indices   []int
+	Distances []float64
+}
+
+// Returns the vertices adjacent to vertex i and the distances to them
+func (g *Graph) Neighbors(i int) ([]int, []float64) {
+	return g.Indices[g.Offsets[i]:g.Offsets[i+1]], g.Distances[g.Offsets[i]:g.Offsets[i+1]]
+}
+
+type Symmetrization int
+
+const (
+	// Keep an edge from each point to each of its k nearest neighbours
+	Directed Symmetrization = iota
+	// Keep an edge in both directions if either point is among the k nearest of the other
+	UnionSymmetrization
+	// Keep an edge in both directions only if each point is among the k nearest of the other
+	MutualSymmetrization
+)
+
+type GraphOptions struct {
+	Symmetrization Symmetrization
+	// Defaults to GOMAXPROCS
+	Workers int
+}
+
+// Builds the k-nearest neighbour graph of the points of a tree, in parallel. Points are never
+// their own neighbours, and neighbours at equal distance are ordered by vertex index.
+func KNearestNeighborGraph(tree common.Subtree, k int, options GraphOptions) (*Graph, error) {
+	if err := common.CheckK(k); err != nil {
+		return nil, err
+	}
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	points := newMirror(tree)
+	nearest := newNearestRules(points, points, k, true)
+	if points.root != nil {
+		traverseParallel(points.root, points.root, nearest, workers)
+	}
+
+	adjacency := make([][]neighbor, len(points.points))
+	for i, heap := range nearest.heaps {
+		adjacency[i] = heap.sorted()
+	}
+	switch options.Symmetrization {
+	case Directed:
+	case UnionSymmetrization, MutualSymmetrization:
+		adjacency = symmetrize(adjacency, options.Symmetrization == MutualSymmetrization)
+	default:
+		return nil, fmt.Errorf("Unknown symmetrization %d", options.Symmetrization)
+	}
+
+	graph := &Graph{Points: points.points, Offsets: make([]int, len(adjacency)+1)}
+	for i, neighbours := range adjacency {
+		graph.Offsets[i+1] = graph.Offsets[i] + len(neighbours)
+		for _, n := range neighbours {
+			graph.Indices = append(graph.Indices, n.index)
+			graph.Distances = append(graph.Distances, n.distance)
+		}
+	}
+	return graph, nil
+}
+
+func symmetrize(adjacency [][]neighbor, mutual bool) [][]neighbor {
+	edges := make([]map[int]float64, len(adjacency))
+	for i := range edges {
+		edges[i] = map[int]float64{}
+	}
+	for i, neighbours := range adjacency {
+		for _, n := range neighbours {
+			edges[i][n.index] = n.distance
+		}
+	}
+	result := make([][]neighbor, len(adjacency))
+	for i, neighbours := range adjacency {
+		for _, n := range neighbours {
+			_, reverse := edges[n.index][i]
+			if mutual && !reverse {
+				continue
+			}
+			result[i] = append(result[i], n)
+			if !reverse {
+				result[n.index] = append(result[n.index], neighbor{index: i, distance: n.distance})
+			}
+		}
+	}
+	for _, neighbours := range result {
+		sort.Slice(neighbours, func(a, b int) bool { return neighbours[a].before(neighbours[b]) })
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+package dualtree
+
+import "github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+
+// Subtrees with at most this many points are flattened into a single leaf, whose points
+// are compared by brute force. This keeps the number of node pairs visited manageable.
+const leafSize = 16
+
+// node mirrors a common.Subtree with the points moved down into leaves, so that the
+// traversals only ever compare points at pairs of leaves.
+type node struct {
+	id       int
+	bounds   common.Bounds
+	diameter float64
+	children []*node
+	// The points below this node have the contiguous indices [first, last]
+	first int
+	last  int
+}
+
+func (n *node) isLeaf() bool {
+	return n.children == nil
+}
+
+type mirror struct {
+	root    *node
+	points  []common.Point
+	vectors []common.PointVector
+	// Number of nodes, leaves included
+	size int
+	// Nodes are allocated in blocks to spare the garbage collector
+	block []node
+}
+
+func newMirror(tree common.Subtree) *mirror {
+	m := &mirror{}
+	if tree.Pivot() != nil {
+		m.root = m.build(tree)
+	}
+	return m
+}
+
+// Each node of the tree becomes an internal node whose children are a leaf holding its pivot
+// and the mirrors of its own children, unless it is small enough to become a single leaf.
+func (m *mirror) build(tree common.Subtree) *node {
+	n := m.node(tree.Bounds(), len(m.points))
+	pivot := tree.Pivot()
+	m.points = append(m.points, pivot)
+	m.vectors = append(m.vectors, pivot.Vector())
+	left, right := tree.Children()
+	children := make([]*node, 1, 3)
+	if left != nil {
+		children = append(children, m.build(left))
+	}
+	if right != nil {
+		children = append(children, m.build(right))
+	}
+	n.last = len(m.points) - 1
+	if n.last-n.first >= leafSize {
+		children[0] = m.node(common.Bounds{Centre: m.vectors[n.first]}, n.first)
+		n.children = children
+	}
+	return n
+}
+
+func (m *mirror) node(bounds common.Bounds, first int) *node {
+	if len(m.block) == cap(m.block) {
+		m.block = make([]node, 0, 1024)
+	}
+	m.block = append(m.block, node{id: m.size, bounds: bounds, diameter: bounds.Diameter(), first: first, last: first})
+	m.size++
+	return &m.block[len(m.block)-1]
+}
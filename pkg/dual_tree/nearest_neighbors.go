@@ -0,0 +1,186 @@
+package dualtree
+
+import (
+	"math"
+	"sort"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Neighbors lists the nearest reference points of a query point, nearest first
+type Neighbors struct {
+	Point     common.Point
+	Neighbors []common.PointWithDistance
+}
+
+// Finds the k nearest points of the reference tree for every point of the query tree.
+// Either tree may be a KdTree or a BallTree; pairs of nodes are pruned using their bounds.
+func AllKNearestNeighbors(query, reference common.Subtree, k int) ([]Neighbors, error) {
+	return allKNearestNeighbors(query, reference, k, false)
+}
+
+// Finds the k nearest other points of the same tree for every point of the tree
+func AllKNearestNeighborsSelf(tree common.Subtree, k int) ([]Neighbors, error) {
+	return allKNearestNeighbors(tree, tree, k, true)
+}
+
+func allKNearestNeighbors(query, reference common.Subtree, k int, self bool) ([]Neighbors, error) {
+	if err := common.CheckDimension("reference tree", reference.NodeDimension(), query.NodeDimension()); err != nil {
+		return nil, err
+	}
+	if err := common.CheckK(k); err != nil {
+		return nil, err
+	}
+	queries := newMirror(query)
+	references := queries
+	if !self {
+		references = newMirror(reference)
+	}
+	nearest := newNearestRules(queries, references, k, self)
+	if queries.root != nil && references.root != nil {
+		traverse(queries.root, references.root, nearest)
+	}
+	return nearest.results(), nil
+}
+
+// A reference point found for a query, identified by its leaf index
+type neighbor struct {
+	index    int
+	distance float64
+}
+
+// Ties on distance are broken by leaf index, so that results do not depend on visiting order
+func (n neighbor) before(other neighbor) bool {
+	return n.distance < other.distance || (n.distance == other.distance && n.index < other.index)
+}
+
+// A max-heap holding the best k neighbours found so far, worst first
+type neighborHeap []neighbor
+
+func (h *neighborHeap) offer(n neighbor, k int) {
+	heap := *h
+	if len(heap) < k {
+		heap = append(heap, n)
+		for i := len(heap) - 1; i > 0; {
+			parent := (i - 1) / 2
+			if !heap[parent].before(heap[i]) {
+				break
+			}
+			heap[parent], heap[i] = heap[i], heap[parent]
+			i = parent
+		}
+		*h = heap
+		return
+	}
+	if !n.before(heap[0]) {
+		return
+	}
+	heap[0] = n
+	for i := 0; ; {
+		worst := i
+		for _, child := range []int{2*i + 1, 2*i + 2} {
+			if child < len(heap) && heap[worst].before(heap[child]) {
+				worst = child
+			}
+		}
+		if worst == i {
+			break
+		}
+		heap[worst], heap[i] = heap[i], heap[worst]
+		i = worst
+	}
+}
+
+// Distance to the k-th neighbour, or infinity until k have been found
+func (h neighborHeap) bound(k int) float64 {
+	if len(h) < k {
+		return math.Inf(1)
+	}
+	return h[0].distance
+}
+
+func (h neighborHeap) sorted() []neighbor {
+	result := append([]neighbor{}, h...)
+	sort.Slice(result, func(i, j int) bool { return result[i].before(result[j]) })
+	return result
+}
+
+type nearestRules struct {
+	queries    *mirror
+	references *mirror
+	k          int
+	self       bool
+	// Indexed by query leaf index
+	heaps []neighborHeap
+	// Indexed by query node id - no point below needs neighbours further away than this
+	bounds []float64
+	// Indexed by query node id - the smallest k-th neighbour distance of any point below
+	closest []float64
+}
+
+func newNearestRules(queries, references *mirror, k int, self bool) *nearestRules {
+	bounds := make([]float64, queries.size)
+	closest := make([]float64, queries.size)
+	for i := range bounds {
+		bounds[i] = math.Inf(1)
+		closest[i] = math.Inf(1)
+	}
+	return &nearestRules{
+		queries:    queries,
+		references: references,
+		k:          k,
+		self:       self,
+		heaps:      make([]neighborHeap, len(queries.points)),
+		bounds:     bounds,
+		closest:    closest,
+	}
+}
+
+func (rules *nearestRules) score(q, r *node) (float64, bool) {
+	d := q.bounds.MinDistanceTo(r.bounds)
+	return d, d <= rules.bounds[q.id]
+}
+
+func (rules *nearestRules) base(q, r *node) {
+	bound := 0.
+	closest := math.Inf(1)
+	for i := q.first; i <= q.last; i++ {
+		heap := &rules.heaps[i]
+		for j := r.first; j <= r.last; j++ {
+			if rules.self && i == j {
+				continue
+			}
+			d, _ := common.Distance(rules.queries.vectors[i], rules.references.vectors[j])
+			heap.offer(neighbor{index: j, distance: d}, rules.k)
+		}
+		bound = math.Max(bound, heap.bound(rules.k))
+		closest = math.Min(closest, heap.bound(rules.k))
+	}
+	rules.bounds[q.id] = bound
+	rules.closest[q.id] = closest
+}
+
+func (rules *nearestRules) update(q *node) {
+	bound := 0.
+	closest := math.Inf(1)
+	for _, child := range q.children {
+		bound = math.Max(bound, rules.bounds[child.id])
+		closest = math.Min(closest, rules.closest[child.id])
+	}
+	// Any two points below q are at most its diameter apart, so each has k neighbours
+	// within the closest k-th neighbour distance plus the diameter
+	rules.bounds[q.id] = math.Min(bound, closest+q.diameter)
+	rules.closest[q.id] = closest
+}
+
+func (rules *nearestRules) results() []Neighbors {
+	result := make([]Neighbors, len(rules.heaps))
+	for i, heap := range rules.heaps {
+		neighbours := heap.sorted()
+		result[i] = Neighbors{Point: rules.queries.points[i], Neighbors: make([]common.PointWithDistance, len(neighbours))}
+		for j, n := range neighbours {
+			result[i].Neighbors[j] = common.PointWithDistance{Point: rules.references.points[n.index], Distance: n.distance}
+		}
+	}
+	return result
+}
@@ -0,0 +1,51 @@
+package dualtree
+
+import "github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+
+// Calls fn on every pair of points, one from each tree, which lie strictly closer together
+// than radius. The join stops as soon as fn returns false. Pairs of nodes are pruned using
+// their bounds, so this is much faster than searching one tree for each point of the other.
+func RangeJoin(a, b common.Subtree, radius float64, fn func(a, b common.Point, distance float64) bool) error {
+	if err := common.CheckDimension("second tree", b.NodeDimension(), a.NodeDimension()); err != nil {
+		return err
+	}
+	if err := common.CheckRadius(radius); err != nil {
+		return err
+	}
+	queries := newMirror(a)
+	references := newMirror(b)
+	if queries.root != nil && references.root != nil {
+		traverse(queries.root, references.root, &rangeJoinRules{queries: queries, references: references, radius: radius, fn: fn})
+	}
+	return nil
+}
+
+type rangeJoinRules struct {
+	queries    *mirror
+	references *mirror
+	radius     float64
+	fn         func(a, b common.Point, distance float64) bool
+	stopped    bool
+}
+
+func (rules *rangeJoinRules) score(q, r *node) (float64, bool) {
+	if rules.stopped {
+		return 0, false
+	}
+	d := q.bounds.MinDistanceTo(r.bounds)
+	return d, d <= rules.radius
+}
+
+func (rules *rangeJoinRules) base(q, r *node) {
+	for i := q.first; i <= q.last && !rules.stopped; i++ {
+		for j := r.first; j <= r.last; j++ {
+			d, _ := common.Distance(rules.queries.vectors[i], rules.references.vectors[j])
+			if d < rules.radius && !rules.fn(rules.queries.points[i], rules.references.points[j], d) {
+				rules.stopped = true
+				break
+			}
+		}
+	}
+}
+
+func (rules *rangeJoinRules) update(q *node) {}
@@ -0,0 +1,236 @@
+package dualtree
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// SpanningTree connects the points of a tree. Edge endpoints index into Points.
+type SpanningTree struct {
+	Points []common.Point
+	// Lightest first
+	Edges []Edge
+}
+
+type Edge struct {
+	A      int
+	B      int
+	Weight float64
+}
+
+// Builds the Euclidean minimum spanning tree of the points of a tree with the dual-tree Boruvka
+// algorithm. Pairs of nodes whose points all belong to one component are never compared, so
+// later rounds only look between components.
+func MinimumSpanningTree(tree common.Subtree) (*SpanningTree, error) {
+	points := newMirror(tree)
+	return boruvka(points, make([]float64, len(points.points))), nil
+}
+
+// Builds the minimum spanning tree of the points of a tree under the mutual reachability
+// distance max(d(a, b), core(a), core(b)) used by HDBSCAN*, with the dual-tree Boruvka algorithm.
+// Core distances must be non-negative.
+func MutualReachabilitySpanningTree(tree common.Subtree, coreDistance func(common.Point) float64) (*SpanningTree, error) {
+	points := newMirror(tree)
+	core := make([]float64, len(points.points))
+	for i, p := range points.points {
+		core[i] = coreDistance(p)
+		if !(core[i] >= 0) {
+			return nil, fmt.Errorf("Core distances must be non-negative, found %v", core[i])
+		}
+	}
+	return boruvka(points, core), nil
+}
+
+// Each round finds the lightest edge leaving every component in a single dual-tree traversal,
+// then joins the components along those edges, so that there are at most log n rounds.
+func boruvka(points *mirror, core []float64) *SpanningTree {
+	n := len(points.points)
+	result := &SpanningTree{Points: points.points, Edges: make([]Edge, 0, max(n-1, 0))}
+	if n == 0 {
+		return result
+	}
+	rules := &boruvkaRules{
+		points:         points,
+		core:           core,
+		nodeCore:       make([]float64, points.size),
+		components:     newUnionFind(n),
+		pointComponent: make([]int, n),
+		nodeComponent:  make([]int, points.size),
+		candidates:     make([]pair, n),
+		bounds:         make([]float64, points.size),
+	}
+	rules.cacheCore(points.root)
+	for len(result.Edges) < n-1 {
+		for i := range rules.pointComponent {
+			rules.pointComponent[i] = rules.components.find(i)
+			rules.candidates[i] = pair{a: -1, b: -1, distance: math.Inf(1)}
+		}
+		for i := range rules.bounds {
+			rules.bounds[i] = math.Inf(1)
+		}
+		rules.cacheComponents(points.root)
+		traverse(points.root, points.root, rules)
+		joined := false
+		for i, candidate := range rules.candidates {
+			if rules.pointComponent[i] == i && candidate.a >= 0 && rules.components.union(candidate.a, candidate.b) {
+				result.Edges = append(result.Edges, Edge{A: candidate.a, B: candidate.b, Weight: candidate.distance})
+				joined = true
+			}
+		}
+		if !joined {
+			break
+		}
+	}
+	sort.Slice(result.Edges, func(i, j int) bool {
+		a, b := result.Edges[i], result.Edges[j]
+		return pair{a: a.A, b: a.B, distance: a.Weight}.before(pair{a: b.A, b: b.B, distance: b.Weight})
+	})
+	return result
+}
+
+type boruvkaRules struct {
+	points *mirror
+	// Indexed by point index
+	core []float64
+	// Indexed by node id - the smallest core distance below
+	nodeCore   []float64
+	components *unionFind
+	// Indexed by point index, and fixed for the round
+	pointComponent []int
+	// Indexed by node id - the component holding every point below, or -1 if there are several
+	nodeComponent []int
+	// Indexed by component - the lightest edge leaving it found so far, with a < b
+	candidates []pair
+	// Indexed by node id - no point below needs an edge heavier than this
+	bounds []float64
+}
+
+func (rules *boruvkaRules) cacheCore(n *node) float64 {
+	core := math.Inf(1)
+	if n.isLeaf() {
+		for i := n.first; i <= n.last; i++ {
+			core = math.Min(core, rules.core[i])
+		}
+	}
+	for _, child := range n.children {
+		core = math.Min(core, rules.cacheCore(child))
+	}
+	rules.nodeCore[n.id] = core
+	return core
+}
+
+func (rules *boruvkaRules) cacheComponents(n *node) int {
+	component := rules.pointComponent[n.first]
+	if n.isLeaf() {
+		for i := n.first + 1; i <= n.last && component >= 0; i++ {
+			if rules.pointComponent[i] != component {
+				component = -1
+			}
+		}
+	}
+	for _, child := range n.children {
+		if rules.cacheComponents(child) != component {
+			component = -1
+		}
+	}
+	rules.nodeComponent[n.id] = component
+	return component
+}
+
+func (rules *boruvkaRules) score(q, r *node) (float64, bool) {
+	// Edges within a component are never needed
+	if rules.nodeComponent[q.id] >= 0 && rules.nodeComponent[q.id] == rules.nodeComponent[r.id] {
+		return 0, false
+	}
+	d := math.Max(q.bounds.MinDistanceTo(r.bounds), math.Max(rules.nodeCore[q.id], rules.nodeCore[r.id]))
+	return d, d <= rules.bound(q)
+}
+
+// The cached bound of a node goes stale as other nodes find lighter edges for the components
+// below it, but a node within a single component can use that component's best edge directly
+func (rules *boruvkaRules) bound(n *node) float64 {
+	if component := rules.nodeComponent[n.id]; component >= 0 {
+		return rules.candidates[component].distance
+	}
+	return rules.bounds[n.id]
+}
+
+func (rules *boruvkaRules) base(q, r *node) {
+	bound := 0.
+	for i := q.first; i <= q.last; i++ {
+		component := rules.pointComponent[i]
+		candidate := &rules.candidates[component]
+		vector := rules.points.vectors[i]
+		// Check the point against the whole of r before comparing it with each point of r
+		if component != rules.nodeComponent[r.id] && !rules.exceeds(r.bounds.MinDistance(vector), i, rules.nodeCore[r.id], *candidate) {
+			for j := r.first; j <= r.last; j++ {
+				if rules.pointComponent[j] == component || rules.exceeds(0, i, rules.core[j], *candidate) {
+					continue
+				}
+				d, _ := common.Distance(vector, rules.points.vectors[j])
+				edge := pair{a: min(i, j), b: max(i, j), distance: math.Max(d, math.Max(rules.core[i], rules.core[j]))}
+				if edge.before(*candidate) {
+					*candidate = edge
+				}
+			}
+		}
+		bound = math.Max(bound, candidate.distance)
+	}
+	rules.bounds[q.id] = bound
+}
+
+// Whether every edge from point i with at least the given distance, to points with at least
+// the given core distance, would be heavier than the candidate
+func (rules *boruvkaRules) exceeds(distance float64, i int, core float64, candidate pair) bool {
+	return distance > candidate.distance || rules.core[i] > candidate.distance || core > candidate.distance
+}
+
+func (rules *boruvkaRules) update(q *node) {
+	bound := 0.
+	for _, child := range q.children {
+		bound = math.Max(bound, rules.bound(child))
+	}
+	rules.bounds[q.id] = bound
+}
+
+type unionFind struct {
+	parent []int
+	size   []int
+}
+
+func newUnionFind(n int) *unionFind {
+	u := &unionFind{parent: make([]int, n), size: make([]int, n)}
+	for i := range u.parent {
+		u.parent[i] = i
+		u.size[i] = 1
+	}
+	return u
+}
+
+func (u *unionFind) find(i int) int {
+	root := i
+	for u.parent[root] != root {
+		root = u.parent[root]
+	}
+	for u.parent[i] != root {
+		u.parent[i], i = root, u.parent[i]
+	}
+	return root
+}
+
+// Joins the sets holding a and b, returning false if they were already joined
+func (u *unionFind) union(a, b int) bool {
+	a, b = u.find(a), u.find(b)
+	if a == b {
+		return false
+	}
+	if u.size[a] < u.size[b] {
+		a, b = b, a
+	}
+	u.parent[b] = a
+	u.size[a] += u.size[b]
+	return true
+}
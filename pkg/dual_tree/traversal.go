@@ -0,0 +1,97 @@
+package dualtree
+
+import "sync"
+
+// rules decide how a dual-tree traversal treats each pair of query and reference nodes
+type rules interface {
+	// Returns a priority for visiting the pair, lower first, and false if no pair of
+	// points below q and r can affect the result
+	score(q, r *node) (float64, bool)
+	// Compares the points held by two leaves
+	base(q, r *node)
+	// Called after each child of q has been visited against some reference node,
+	// so that any bound cached for q can be tightened
+	update(q *node)
+}
+
+// Visits every pair of leaves below q and r which the rules do not prune
+func traverse(q, r *node, rules rules) {
+	if _, ok := rules.score(q, r); !ok {
+		return
+	}
+	switch {
+	case q.isLeaf() && r.isLeaf():
+		rules.base(q, r)
+	case q.isLeaf() || (!r.isLeaf() && r.diameter > q.diameter):
+		// Descend the larger of the two nodes
+		traverseReferences(q, r.children, rules)
+	default:
+		for _, child := range q.children {
+			traverse(child, r, rules)
+			rules.update(q)
+		}
+	}
+}
+
+type scoredNode struct {
+	node  *node
+	score float64
+}
+
+// Visits the reference nodes in order of score, so the most promising are seen first
+func traverseReferences(q *node, references []*node, rules rules) {
+	// Nodes have at most three children, so sort them in place without allocating
+	var buffer [3]scoredNode
+	scored := buffer[:0]
+	for _, r := range references {
+		if score, ok := rules.score(q, r); ok {
+			scored = append(scored, scoredNode{node: r, score: score})
+			for i := len(scored) - 1; i > 0 && scored[i].score < scored[i-1].score; i-- {
+				scored[i], scored[i-1] = scored[i-1], scored[i]
+			}
+		}
+	}
+	for _, r := range scored {
+		traverse(q, r.node, rules)
+	}
+}
+
+// Splits the query tree into disjoint subtrees and traverses each against r on its own
+// goroutine. The rules must only change state belonging to the query nodes they are given.
+func traverseParallel(q, r *node, rules rules, workers int) {
+	if workers <= 1 {
+		traverse(q, r, rules)
+		return
+	}
+	// Repeatedly split the largest subtree until there is plenty of work to share out
+	frontier := []*node{q}
+	for len(frontier) < 4*workers {
+		largest := -1
+		for i, n := range frontier {
+			if !n.isLeaf() && (largest < 0 || n.last-n.first > frontier[largest].last-frontier[largest].first) {
+				largest = i
+			}
+		}
+		if largest < 0 {
+			break
+		}
+		children := frontier[largest].children
+		frontier = append(append(frontier[:largest:largest], frontier[largest+1:]...), children...)
+	}
+	tasks := make(chan *node)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				traverse(task, r, rules)
+			}
+		}()
+	}
+	for _, task := range frontier {
+		tasks <- task
+	}
+	close(tasks)
+	wg.Wait()
+}
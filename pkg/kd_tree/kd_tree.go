@@ -1,8 +1,8 @@
 package kdtree
 
 import (
-	"fmt"
 	"math"
+	"math/rand"
 
 	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
 )
@@ -12,51 +12,131 @@ type KdTree struct {
 	Left      *KdTree     `json:"left"`
 	Right     *KdTree     `json:"right"`
 	Dimension int         `json:"dimension"`
+	// Cached at every node when set
+	aggregate *common.Aggregate
+	// The IdentifiedPoints of the tree by ID, kept at the top of the tree only
+	ids common.IDIndex
 }
 
 var _tree common.SpacePartitioningTree = &KdTree{}
+var _subtree common.Subtree = &KdTree{}
 
-func (tree *KdTree) Construct(points []common.Point, dimension int) error {
-	points = common.Filter(points, func(p common.Point) bool {
-		return p.Dimension() == dimension
-	})
+func (tree *KdTree) Construct(points []common.Point, dimension int, options ...common.ConstructOption) error {
+	settings := common.NewConstructOptions(options...)
+	points, err := settings.Accept(points, dimension)
+	if err != nil {
+		return err
+	}
+	ids, err := common.NewIDIndex(points)
+	if err != nil {
+		return err
+	}
+	if len(points) > 0 {
+		if err := common.CheckPositiveDimension("tree", dimension); err != nil {
+			return err
+		}
+	}
+	tree.Root, tree.Left, tree.Right = nil, nil, nil
 	tree.Dimension = dimension
+	tree.aggregate = settings.Aggregate
+	tree.ids = ids
 	ordinateIndex := 0
-	err := tree.recursivelyConstruct(points, ordinateIndex)
+	err = tree.recursivelyConstruct(points, ordinateIndex, settings.Random)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (tree *KdTree) recursivelyConstruct(points []common.Point, ordinateIndex int) error {
+func (tree *KdTree) recursivelyConstruct(points []common.Point, ordinateIndex int, random *rand.Rand) error {
 	if len(points) == 0 {
 		return nil
 	}
 	ordinateValues := common.Map(points, func(p common.Point) float64 { return p.Vector()[ordinateIndex] })
-	pivot, smaller, larger, err := common.FindMedianByOrdering(ordinateValues, points)
+	pivot, smaller, larger, err := common.FindMedianByOrdering(ordinateValues, points, random)
 	if err != nil {
 		return err
 	}
 	tree.Root = &KdTreeNode{Vector: pivot.Vector(), Data: pivot, OrdinateIndex: ordinateIndex, SplittingValue: pivot.Vector()[ordinateIndex]}
 	if len(smaller) > 0 {
-		tree.Left = &KdTree{Dimension: tree.Dimension}
-		tree.Left.recursivelyConstruct(smaller, (ordinateIndex+1)%tree.Dimension)
+		tree.Left = &KdTree{Dimension: tree.Dimension, aggregate: tree.aggregate}
+		if err := tree.Left.recursivelyConstruct(smaller, (ordinateIndex+1)%tree.Dimension, random); err != nil {
+			return err
+		}
 	}
 	if len(larger) > 0 {
-		tree.Right = &KdTree{Dimension: tree.Dimension}
-		tree.Right.recursivelyConstruct(larger, (ordinateIndex+1)%tree.Dimension)
+		tree.Right = &KdTree{Dimension: tree.Dimension, aggregate: tree.aggregate}
+		if err := tree.Right.recursivelyConstruct(larger, (ordinateIndex+1)%tree.Dimension, random); err != nil {
+			return err
+		}
 	}
+	tree.refresh()
 	return nil
 }
 
+// Recomputes the values cached at the root from its own point and its children
+func (tree *KdTree) refresh() {
+	tree.fitBoundingBox()
+	tree.Root.SubtreeSize = 1
+	tree.Root.SubtreeWeight = common.Weight(tree.Root.Data)
+	for _, child := range []*KdTree{tree.Left, tree.Right} {
+		if child != nil {
+			tree.Root.SubtreeSize += child.Size()
+			tree.Root.SubtreeWeight += child.weight()
+		}
+	}
+	if tree.aggregate != nil {
+		tree.Root.Aggregate = tree.aggregate.Lift(tree.Root.Data)
+		if tree.Left != nil {
+			tree.Root.Aggregate = tree.aggregate.Combine(tree.Left.Root.Aggregate, tree.Root.Aggregate)
+		}
+		if tree.Right != nil {
+			tree.Root.Aggregate = tree.aggregate.Combine(tree.Root.Aggregate, tree.Right.Root.Aggregate)
+		}
+	}
+}
+
+// Sets the bounding box of the root from its own point and the boxes of its children
+func (tree *KdTree) fitBoundingBox() {
+	tree.Root.Min = append(common.PointVector{}, tree.Root.Vector...)
+	tree.Root.Max = append(common.PointVector{}, tree.Root.Vector...)
+	for _, child := range []*KdTree{tree.Left, tree.Right} {
+		if child == nil {
+			continue
+		}
+		for i := range tree.Root.Min {
+			tree.Root.Min[i] = math.Min(tree.Root.Min[i], child.Root.Min[i])
+			tree.Root.Max[i] = math.Max(tree.Root.Max[i], child.Root.Max[i])
+		}
+	}
+}
+
 func (tree KdTree) Search(point common.Point, distance float64) ([]common.Point, error) {
-	if point.Dimension() != tree.Dimension {
-		return nil, fmt.Errorf("The query point has dimension %d, but the nodes of the tree are of dimension %d", point.Dimension(), tree.Dimension)
+	result := []common.Point{}
+	err := tree.SearchFunc(point, distance, func(p common.Point) bool {
+		result = append(result, p)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Calls fn on every point within distance of the query point, stopping as soon as fn returns false.
+// Unlike Search, no result slice is built.
+func (tree KdTree) SearchFunc(point common.Point, distance float64, fn func(common.Point) bool) error {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return err
+	}
+	if err := common.CheckRadius(distance); err != nil {
+		return err
+	}
+	if tree.Root == nil {
+		return nil
 	}
 	pointVector := point.Vector()
 	queryStack := []*KdTree{}
-	result := []common.Point{}
 	currentNode := &tree
 	for currentNode != nil || len(queryStack) > 0 {
 		if currentNode != nil {
@@ -70,10 +150,10 @@ func (tree KdTree) Search(point common.Point, distance float64) ([]common.Point,
 			currentNode, queryStack = queryStack[len(queryStack)-1], queryStack[:len(queryStack)-1]
 			d, err := common.Distance(pointVector, currentNode.Root.Vector)
 			if err != nil {
-				return nil, err
+				return err
 			}
-			if d < distance {
-				result = append(result, currentNode.Root.Data)
+			if d < distance && !fn(currentNode.Root.Data) {
+				return nil
 			}
 			if currentNode.Root.SearchRight(pointVector, distance) {
 				currentNode = currentNode.Right
@@ -82,56 +162,30 @@ func (tree KdTree) Search(point common.Point, distance float64) ([]common.Point,
 			}
 		}
 	}
-	return result, nil
+	return nil
 }
 
+// Returns the k points of the tree nearest to the query point, nearest first, or every point
+// if the tree holds fewer than k
 func (tree KdTree) KNearestNeighbors(point common.Point, k int) ([]common.Point, error) {
-
-	if point.Dimension() != tree.Dimension {
-		return nil, fmt.Errorf("The query point has dimension %d, but the nodes of the tree are of dimension %d", point.Dimension(), tree.Dimension)
-	}
-	pointVector := point.Vector()
-	var candidateNeighbours []common.Point
-	var newNode *KdTree
-	currentNode := &tree
-	for currentNode != nil {
-		ordinateIndex := currentNode.Root.OrdinateIndex
-		split := currentNode.Root.SplittingValue
-		if pointVector[ordinateIndex] > split {
-			newNode = currentNode.Right
-		} else {
-			newNode = currentNode.Left
-		}
-		if newNode.Size() < k {
-			candidateNeighbours = currentNode.Points()
-			break
-		} else {
-			currentNode = newNode
-		}
+	if tree.Root == nil {
+		return nil, common.ErrEmptyTree
 	}
-	distances := common.Map(candidateNeighbours, func(candidate common.Point) float64 {
-		d, _ := common.Distance(candidate.Vector(), pointVector)
-		return d
-	})
-	candidateDistance := common.Reduce(distances, 0., math.Max)
-
-	candidateNeighbours, err := tree.Search(point, candidateDistance)
+	it, err := tree.NearestNeighborIterator(point)
 	if err != nil {
 		return nil, err
 	}
-	var candidatesWithDistances common.PointWithDistanceHeap
-	candidatesWithDistances = common.Map(candidateNeighbours, func(candidate common.Point) common.PointWithDistance {
-		d, _ := common.Distance(candidate.Vector(), pointVector)
-		return common.PointWithDistance{Point: candidate, Distance: d}
-	})
-
-	for len(candidatesWithDistances) > k {
-		candidatesWithDistances.Pop()
+	if err := common.CheckK(k); err != nil {
+		return nil, err
+	}
+	result := []common.Point{}
+	for len(result) < k {
+		p, _, ok := it.Next()
+		if !ok {
+			break
+		}
+		result = append(result, p)
 	}
-
-	result := common.Map(candidatesWithDistances, func(c common.PointWithDistance) common.Point {
-		return c.Point
-	})
 	return result, nil
 }
 
@@ -139,9 +193,37 @@ func (tree KdTree) NodeDimension() int {
 	return tree.Dimension
 }
 
+func (tree KdTree) Pivot() common.Point {
+	if tree.Root == nil {
+		return nil
+	}
+	return tree.Root.Data
+}
+
+func (tree KdTree) Bounds() common.Bounds {
+	if tree.Root == nil {
+		return common.Bounds{}
+	}
+	return common.Bounds{Min: tree.Root.Min, Max: tree.Root.Max}
+}
+
+func (tree KdTree) Children() (common.Subtree, common.Subtree) {
+	var left, right common.Subtree
+	if tree.Left != nil {
+		left = tree.Left
+	}
+	if tree.Right != nil {
+		right = tree.Right
+	}
+	return left, right
+}
+
+// Returns the number of points in the tree, from the size cached at the root when it is known
 func (tree KdTree) Size() int {
 	if tree.Root == nil {
 		return 0
+	} else if tree.Root.SubtreeSize > 0 {
+		return tree.Root.SubtreeSize
 	} else if tree.Left == nil && tree.Right == nil {
 		return 1
 	} else if tree.Left == nil {
@@ -152,6 +234,23 @@ func (tree KdTree) Size() int {
 	return 1 + tree.Left.Size() + tree.Right.Size()
 }
 
+// Returns the total weight of the points in the tree, from the weight cached at the root when
+// the size is known
+func (tree KdTree) weight() float64 {
+	if tree.Root == nil {
+		return 0
+	} else if tree.Root.SubtreeSize > 0 {
+		return tree.Root.SubtreeWeight
+	}
+	result := common.Weight(tree.Root.Data)
+	for _, child := range []*KdTree{tree.Left, tree.Right} {
+		if child != nil {
+			result += child.weight()
+		}
+	}
+	return result
+}
+
 func (tree KdTree) Depth() int {
 	if tree.Root == nil {
 		return 0
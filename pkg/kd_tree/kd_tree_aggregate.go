@@ -0,0 +1,65 @@
+package kdtree
+
+import (
+	"math"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Returns the aggregate the tree was constructed with over the points inside the region.
+// When the region is a ContainingRegion, subtrees lying wholly inside it contribute their
+// cached value without being visited.
+func (tree KdTree) AggregateRegion(region common.Region) (any, error) {
+	if tree.aggregate == nil {
+		return nil, common.ErrNoAggregate
+	}
+	if err := common.CheckRegion(region, tree.Dimension); err != nil {
+		return nil, err
+	}
+	if tree.Root == nil {
+		return tree.aggregate.Identity, nil
+	}
+	containing, _ := region.(common.ContainingRegion)
+	min := make(common.PointVector, tree.Dimension)
+	max := make(common.PointVector, tree.Dimension)
+	for i := range min {
+		min[i] = math.Inf(-1)
+		max[i] = math.Inf(1)
+	}
+	return tree.aggregateRegion(region, containing, min, max), nil
+}
+
+// As countRegion, combining the left subtree, the root and the right subtree in that order
+func (tree *KdTree) aggregateRegion(region common.Region, containing common.ContainingRegion, min, max common.PointVector) any {
+	if tree.Root.Min != nil {
+		min, max = tree.Root.Min, tree.Root.Max
+	}
+	if !region.IntersectsBox(min, max) {
+		return tree.aggregate.Identity
+	}
+	if containing != nil && containing.ContainsBox(min, max) {
+		return tree.Root.Aggregate
+	}
+	result := tree.aggregate.Identity
+	ordinateIndex := tree.Root.OrdinateIndex
+	if tree.Left != nil {
+		leftMax := max
+		if tree.Left.Root.Min == nil {
+			leftMax = append(common.PointVector{}, max...)
+			leftMax[ordinateIndex] = math.Min(leftMax[ordinateIndex], tree.Root.SplittingValue)
+		}
+		result = tree.Left.aggregateRegion(region, containing, min, leftMax)
+	}
+	if region.Contains(tree.Root.Vector) {
+		result = tree.aggregate.Combine(result, tree.aggregate.Lift(tree.Root.Data))
+	}
+	if tree.Right != nil {
+		rightMin := min
+		if tree.Right.Root.Min == nil {
+			rightMin = append(common.PointVector{}, min...)
+			rightMin[ordinateIndex] = math.Max(rightMin[ordinateIndex], tree.Root.SplittingValue)
+		}
+		result = tree.aggregate.Combine(result, tree.Right.aggregateRegion(region, containing, rightMin, max))
+	}
+	return result
+}
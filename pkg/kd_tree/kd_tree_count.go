@@ -0,0 +1,131 @@
+package kdtree
+
+import (
+	"math"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Returns the number of points strictly within distance of the query point, without building
+// a result slice as Search does
+func (tree KdTree) Count(point common.Point, distance float64) (int, error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return 0, err
+	}
+	if err := common.CheckRadius(distance); err != nil {
+		return 0, err
+	}
+	return tree.CountRegion(common.Sphere{Centre: point.Vector(), Radius: distance})
+}
+
+// Returns the total weight of the points strictly within distance of the query point
+func (tree KdTree) WeightedCount(point common.Point, distance float64) (float64, error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return 0, err
+	}
+	if err := common.CheckRadius(distance); err != nil {
+		return 0, err
+	}
+	return tree.WeightedCountRegion(common.Sphere{Centre: point.Vector(), Radius: distance})
+}
+
+// Returns the number of points in the closed box [min, max]
+func (tree KdTree) CountBox(min, max common.PointVector) (int, error) {
+	if err := checkBox(min, max, tree.Dimension); err != nil {
+		return 0, err
+	}
+	return tree.CountRegion(common.Box{Min: min, Max: max})
+}
+
+// Returns the total weight of the points in the closed box [min, max]
+func (tree KdTree) WeightedCountBox(min, max common.PointVector) (float64, error) {
+	if err := checkBox(min, max, tree.Dimension); err != nil {
+		return 0, err
+	}
+	return tree.WeightedCountRegion(common.Box{Min: min, Max: max})
+}
+
+// Returns the number of points inside the region. When the region is a ContainingRegion,
+// subtrees lying wholly inside it are counted from their cached size without being visited.
+func (tree KdTree) CountRegion(region common.Region) (int, error) {
+	count, err := tree.weighRegion(region, false)
+	return int(count), err
+}
+
+// Returns the total weight of the points inside the region, as given by common.Weight. Cached
+// subtree weights are used just as CountRegion uses cached sizes.
+func (tree KdTree) WeightedCountRegion(region common.Region) (float64, error) {
+	return tree.weighRegion(region, true)
+}
+
+// Counts the points inside the region, or sums their weights
+func (tree KdTree) weighRegion(region common.Region, weighted bool) (float64, error) {
+	if err := common.CheckRegion(region, tree.Dimension); err != nil {
+		return 0, err
+	}
+	if tree.Root == nil {
+		return 0, nil
+	}
+	containing, _ := region.(common.ContainingRegion)
+	min := make(common.PointVector, tree.Dimension)
+	max := make(common.PointVector, tree.Dimension)
+	for i := range min {
+		min[i] = math.Inf(-1)
+		max[i] = math.Inf(1)
+	}
+	return tree.countRegion(region, containing, min, max, weighted), nil
+}
+
+// Subtrees are bounded by their own boxes where known, and otherwise by the cells cut out by
+// the split planes of their ancestors
+func (tree *KdTree) countRegion(region common.Region, containing common.ContainingRegion, min, max common.PointVector, weighted bool) float64 {
+	if tree.Root.Min != nil {
+		min, max = tree.Root.Min, tree.Root.Max
+	}
+	if !region.IntersectsBox(min, max) {
+		return 0
+	}
+	if containing != nil && containing.ContainsBox(min, max) {
+		if weighted {
+			return tree.weight()
+		}
+		return float64(tree.Size())
+	}
+	count := 0.
+	if region.Contains(tree.Root.Vector) {
+		count += pointWeight(tree.Root.Data, weighted)
+	}
+	ordinateIndex := tree.Root.OrdinateIndex
+	if tree.Left != nil {
+		leftMax := max
+		if tree.Left.Root.Min == nil {
+			leftMax = append(common.PointVector{}, max...)
+			leftMax[ordinateIndex] = math.Min(leftMax[ordinateIndex], tree.Root.SplittingValue)
+		}
+		count += tree.Left.countRegion(region, containing, min, leftMax, weighted)
+	}
+	if tree.Right != nil {
+		rightMin := min
+		if tree.Right.Root.Min == nil {
+			rightMin = append(common.PointVector{}, min...)
+			rightMin[ordinateIndex] = math.Max(rightMin[ordinateIndex], tree.Root.SplittingValue)
+		}
+		count += tree.Right.countRegion(region, containing, rightMin, max, weighted)
+	}
+	return count
+}
+
+func checkBox(min, max common.PointVector, dimension int) error {
+	if err := common.CheckDimension("box's lower corner", len(min), dimension); err != nil {
+		return err
+	}
+	return common.CheckDimension("box's upper corner", len(max), dimension)
+}
+
+// The weight of a point, or one when counting
+func pointWeight(p common.Point, weighted bool) float64 {
+	if weighted {
+		return common.Weight(p)
+	}
+	return 1
+}
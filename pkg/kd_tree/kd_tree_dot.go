@@ -0,0 +1,29 @@
+package kdtree
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Writes the tree as a Graphviz digraph, labelling each internal node with the ordinate it
+// splits on and the splitting value. Leaves split nothing, so are labelled only by their points.
+func (tree KdTree) WriteDOT(w io.Writer, options common.DOTOptions) error {
+	return common.WriteDOT(w, "KdTree", &tree, options, func(node common.Subtree) []string {
+		subtree := node.(*KdTree)
+		if subtree.Left == nil && subtree.Right == nil {
+			return nil
+		}
+		root := subtree.Root
+		return []string{fmt.Sprintf("x%d = %s", root.OrdinateIndex, common.FormatFloat(root.SplittingValue))}
+	})
+}
+
+// Returns the digraph written by WriteDOT
+func (tree KdTree) DOT(options common.DOTOptions) (string, error) {
+	var builder strings.Builder
+	err := tree.WriteDOT(&builder, options)
+	return builder.String(), err
+}
@@ -0,0 +1,49 @@
+package kdtree
+
+import (
+	"math"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// A subtree together with the cell cut out by the split planes of its ancestors
+type kdCell struct {
+	tree *KdTree
+	min  common.PointVector
+	max  common.PointVector
+}
+
+// Returns an iterator over every point of the tree in increasing distance from the query point.
+// Points are found lazily, so the cost depends on how many are consumed.
+func (tree KdTree) NearestNeighborIterator(point common.Point) (*common.NeighborIterator, error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return nil, err
+	}
+	pointVector := point.Vector()
+	expand := func(node any, visit func(any, float64), emit func(common.Point, float64)) {
+		cell := node.(kdCell)
+		d, _ := common.Distance(pointVector, cell.tree.Root.Vector)
+		emit(cell.tree.Root.Data, d)
+		ordinateIndex := cell.tree.Root.OrdinateIndex
+		if cell.tree.Left != nil {
+			leftMax := append(common.PointVector{}, cell.max...)
+			leftMax[ordinateIndex] = cell.tree.Root.SplittingValue
+			visit(kdCell{tree: cell.tree.Left, min: cell.min, max: leftMax}, common.MinDistanceToBox(pointVector, cell.min, leftMax))
+		}
+		if cell.tree.Right != nil {
+			rightMin := append(common.PointVector{}, cell.min...)
+			rightMin[ordinateIndex] = cell.tree.Root.SplittingValue
+			visit(kdCell{tree: cell.tree.Right, min: rightMin, max: cell.max}, common.MinDistanceToBox(pointVector, rightMin, cell.max))
+		}
+	}
+	if tree.Root == nil {
+		return common.NewNeighborIterator(nil, expand), nil
+	}
+	min := make(common.PointVector, tree.Dimension)
+	max := make(common.PointVector, tree.Dimension)
+	for i := range min {
+		min[i] = math.Inf(-1)
+		max[i] = math.Inf(1)
+	}
+	return common.NewNeighborIterator(kdCell{tree: &tree, min: min, max: max}, expand), nil
+}
@@ -8,6 +8,15 @@ type KdTreeNode struct {
 	// The index of the ordinate on which this node is split
 	OrdinateIndex  int     `json:"OrdinateIndex"`
 	SplittingValue float64 `json:"SplittingValue"`
+	// The smallest axis aligned box containing every point of the subtree
+	Min common.PointVector `json:"Min"`
+	Max common.PointVector `json:"Max"`
+	// The number of points in the subtree, or zero if unknown
+	SubtreeSize int `json:"SubtreeSize"`
+	// The total weight of the points in the subtree, as given by common.Weight
+	SubtreeWeight float64 `json:"SubtreeWeight"`
+	// The aggregate of the points of the subtree, if the tree was built with one
+	Aggregate any `json:"-"`
 }
 
 func (node KdTreeNode) Node() common.Point {
@@ -0,0 +1,16 @@
+package kdtree
+
+import (
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	dualtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/dual_tree"
+)
+
+// Returns the k pairs of distinct points of the tree lying closest together, closest first
+func (tree KdTree) ClosestPairs(k int) ([]common.PointPair, error) {
+	return dualtree.ClosestPairsSelf(tree, k)
+}
+
+// Returns the k closest pairs made of a point of this tree and a point of the other, closest first
+func (tree KdTree) ClosestPairsWith(other common.Subtree, k int) ([]common.PointPair, error) {
+	return dualtree.ClosestPairs(tree, other, k)
+}
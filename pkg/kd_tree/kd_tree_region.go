@@ -0,0 +1,51 @@
+package kdtree
+
+import (
+	"math"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Returns every point of the tree lying inside the region. Subtrees are pruned using their own
+// boxes where known, as in CountRegion, and otherwise the cells cut out by the split planes of
+// their ancestors.
+func (tree KdTree) QueryRegion(region common.Region) ([]common.Point, error) {
+	if err := common.CheckRegion(region, tree.Dimension); err != nil {
+		return nil, err
+	}
+	result := []common.Point{}
+	if tree.Root == nil {
+		return result, nil
+	}
+	min := make(common.PointVector, tree.Dimension)
+	max := make(common.PointVector, tree.Dimension)
+	for i := range min {
+		min[i] = math.Inf(-1)
+		max[i] = math.Inf(1)
+	}
+	return tree.queryRegion(region, min, max, result), nil
+}
+
+func (tree *KdTree) queryRegion(region common.Region, min, max common.PointVector, result []common.Point) []common.Point {
+	if tree.Root.Min != nil {
+		min, max = tree.Root.Min, tree.Root.Max
+	}
+	if !region.IntersectsBox(min, max) {
+		return result
+	}
+	if region.Contains(tree.Root.Vector) {
+		result = append(result, tree.Root.Data)
+	}
+	ordinateIndex := tree.Root.OrdinateIndex
+	if tree.Left != nil {
+		leftMax := append(common.PointVector{}, max...)
+		leftMax[ordinateIndex] = tree.Root.SplittingValue
+		result = tree.Left.queryRegion(region, min, leftMax, result)
+	}
+	if tree.Right != nil {
+		rightMin := append(common.PointVector{}, min...)
+		rightMin[ordinateIndex] = tree.Root.SplittingValue
+		result = tree.Right.queryRegion(region, rightMin, max, result)
+	}
+	return result
+}
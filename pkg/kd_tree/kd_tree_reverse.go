@@ -0,0 +1,162 @@
+package kdtree
+
+import (
+	"errors"
+	"math"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+type reverseNeighborRadius struct {
+	// Distance from the pivot of a subtree to its k-th nearest neighbour
+	point float64
+	// Largest such distance over the whole subtree
+	subtree float64
+}
+
+// ReverseNeighborIndex holds the k-nearest radius of every point of a tree, so that reverse
+// nearest neighbour queries need only visit the subtrees which may hold answers. It describes
+// the tree, and the facilities tree if any, as they were when it was built, so it must be built
+// again once either changes. Queries do not modify it, so it may be shared between goroutines.
+type ReverseNeighborIndex struct {
+	tree  *KdTree
+	radii map[*KdTree]reverseNeighborRadius
+}
+
+// Computes the distance from every point of the tree to its k-th nearest other point
+func (tree *KdTree) ReverseNeighborIndex(k int) (*ReverseNeighborIndex, error) {
+	return tree.reverseNeighborIndex(k, nil)
+}
+
+// Computes the distance from every point of the tree to its k-th nearest facility
+func (tree *KdTree) BichromaticReverseNeighborIndex(k int, facilities common.SpacePartitioningTree) (*ReverseNeighborIndex, error) {
+	if facilities == nil {
+		return nil, common.ErrNoFacilities
+	}
+	if err := common.CheckDimension("facilities tree", facilities.NodeDimension(), tree.Dimension); err != nil {
+		return nil, err
+	}
+	return tree.reverseNeighborIndex(k, facilities)
+}
+
+func (tree *KdTree) reverseNeighborIndex(k int, facilities common.SpacePartitioningTree) (*ReverseNeighborIndex, error) {
+	if err := common.CheckK(k); err != nil {
+		return nil, err
+	}
+	index := &ReverseNeighborIndex{tree: tree, radii: map[*KdTree]reverseNeighborRadius{}}
+	if tree.Root != nil {
+		if _, err := tree.kNearestRadii(tree, k, facilities, index.radii); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// Returns the points of the tree which would have the query point among their k nearest
+// neighbours, were it added to the tree. The index of k-nearest radii is built afresh, so
+// repeated queries should share one from ReverseNeighborIndex instead.
+func (tree *KdTree) ReverseKNearestNeighbors(point common.Point, k int) ([]common.Point, error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return nil, err
+	}
+	index, err := tree.ReverseNeighborIndex(k)
+	if err != nil {
+		return nil, err
+	}
+	return index.ReverseKNearestNeighbors(point)
+}
+
+// Returns the points of the tree which would have the query point among their k nearest
+// facilities, were it added to the facilities tree. As with ReverseKNearestNeighbors, repeated
+// queries should share an index from BichromaticReverseNeighborIndex.
+func (tree *KdTree) BichromaticReverseKNearestNeighbors(point common.Point, k int, facilities common.SpacePartitioningTree) ([]common.Point, error) {
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return nil, err
+	}
+	index, err := tree.BichromaticReverseNeighborIndex(k, facilities)
+	if err != nil {
+		return nil, err
+	}
+	return index.ReverseKNearestNeighbors(point)
+}
+
+// Returns the points of the indexed tree which would have the query point among their k
+// nearest neighbours, or facilities for a bichromatic index
+func (index *ReverseNeighborIndex) ReverseKNearestNeighbors(point common.Point) ([]common.Point, error) {
+	tree := index.tree
+	if err := common.CheckDimension("query point", point.Dimension(), tree.Dimension); err != nil {
+		return nil, err
+	}
+	result := []common.Point{}
+	if tree.Root == nil {
+		return result, nil
+	}
+
+	// Filter - a subtree can only hold answers if the query lies within the largest k-nearest
+	// radius of its points. Refine - check each surviving point against its own radius.
+	pointVector := point.Vector()
+	min := make(common.PointVector, tree.Dimension)
+	max := make(common.PointVector, tree.Dimension)
+	for i := range min {
+		min[i] = math.Inf(-1)
+		max[i] = math.Inf(1)
+	}
+	var visit func(subtree *KdTree, min, max common.PointVector)
+	visit = func(subtree *KdTree, min, max common.PointVector) {
+		radius := index.radii[subtree]
+		if common.MinDistanceToBox(pointVector, min, max) > radius.subtree {
+			return
+		}
+		if d, _ := common.Distance(pointVector, subtree.Root.Vector); d <= radius.point {
+			result = append(result, subtree.Root.Data)
+		}
+		ordinateIndex := subtree.Root.OrdinateIndex
+		if subtree.Left != nil {
+			leftMax := append(common.PointVector{}, max...)
+			leftMax[ordinateIndex] = subtree.Root.SplittingValue
+			visit(subtree.Left, min, leftMax)
+		}
+		if subtree.Right != nil {
+			rightMin := append(common.PointVector{}, min...)
+			rightMin[ordinateIndex] = subtree.Root.SplittingValue
+			visit(subtree.Right, rightMin, max)
+		}
+	}
+	visit(tree, min, max)
+	return result, nil
+}
+
+// Records the k-nearest radius of every point below subtree, returning the largest. The
+// neighbours are looked up among the facilities, or else in the whole tree.
+func (tree *KdTree) kNearestRadii(subtree *KdTree, k int, facilities common.SpacePartitioningTree, radii map[*KdTree]reverseNeighborRadius) (float64, error) {
+	var neighbours []common.Point
+	var err error
+	n := k
+	if facilities == nil {
+		// The nearest neighbour of a point of the tree is itself, so look one further
+		n = k + 1
+		neighbours, err = tree.KNearestNeighbors(subtree.Root.Data, n)
+	} else {
+		neighbours, err = facilities.KNearestNeighbors(subtree.Root.Data, n)
+	}
+	// With no facilities at all, every point would have the query among its nearest
+	if err != nil && !errors.Is(err, common.ErrEmptyTree) {
+		return 0, err
+	}
+	radius := math.Inf(1)
+	if len(neighbours) == n {
+		radius, _ = common.Distance(subtree.Root.Vector, neighbours[n-1].Vector())
+	}
+	largest := radius
+	for _, child := range []*KdTree{subtree.Left, subtree.Right} {
+		if child != nil {
+			childRadius, err := tree.kNearestRadii(child, k, facilities, radii)
+			if err != nil {
+				return 0, err
+			}
+			largest = math.Max(largest, childRadius)
+		}
+	}
+	radii[subtree] = reverseNeighborRadius{point: radius, subtree: largest}
+	return largest, nil
+}
@@ -0,0 +1,53 @@
+//go:build go1.23
+
+package kdtree_test
+
+import (
+	"testing"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	kdtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/kd_tree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanRangeOverSearchResults(t *testing.T) {
+	nPoints := 1000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	testPoint := createPoint(dimension, -100, 100)
+	tree := kdtree.KdTree{}
+	tree.Construct(points, dimension)
+	expected, _ := tree.Search(testPoint, 80)
+	seq, err := tree.SearchSeq(testPoint, 80)
+	assert.Nil(t, err, "No error should be returned")
+	result := []common.Point{}
+	for p := range seq {
+		result = append(result, p)
+	}
+	assert.ElementsMatch(t, expected, result, "Expecting the iterator to yield the same points as Search")
+
+	_, err = tree.SearchSeq(createPoint(dimension+1, -100, 100), 80)
+	assert.NotNil(t, err, "Expecting an error for a query point of the wrong dimension")
+}
+
+func TestCanRangeOverNearestNeighbours(t *testing.T) {
+	nPoints := 1000
+	dimension := 3
+	points := createPoints(nPoints, dimension, -100, 100)
+	testPoint := createPoint(dimension, -100, 100)
+	tree := kdtree.KdTree{}
+	tree.Construct(points, dimension)
+	seq, err := tree.NearestNeighborSeq(testPoint)
+	assert.Nil(t, err, "No error should be returned")
+	count := 0
+	previous := 0.
+	for _, d := range seq {
+		assert.GreaterOrEqual(t, d, previous, "Expecting points in increasing distance from the query")
+		previous = d
+		count++
+		if count == 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, count, "Expecting to stop after breaking out of the loop")
+}
@@ -0,0 +1,8 @@
+package kdtree
+
+import dualtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/dual_tree"
+
+// Returns the Euclidean minimum spanning tree of the points of the tree
+func (tree KdTree) MinimumSpanningTree() (*dualtree.SpanningTree, error) {
+	return dualtree.MinimumSpanningTree(tree)
+}
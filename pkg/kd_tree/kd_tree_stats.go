@@ -0,0 +1,29 @@
+package kdtree
+
+import "github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+
+type KdTreeStats struct {
+	common.TreeStats
+	// AxisUsage[i] is the number of nodes with children which split on ordinate i
+	AxisUsage []int
+}
+
+// Describes the shape of the tree and how often each axis is split on
+func (tree KdTree) Stats() KdTreeStats {
+	result := KdTreeStats{TreeStats: common.NewTreeStats(&tree), AxisUsage: make([]int, tree.Dimension)}
+	if tree.Root != nil {
+		tree.countAxes(result.AxisUsage)
+	}
+	return result
+}
+
+func (tree *KdTree) countAxes(usage []int) {
+	if tree.Left != nil || tree.Right != nil {
+		usage[tree.Root.OrdinateIndex]++
+	}
+	for _, child := range []*KdTree{tree.Left, tree.Right} {
+		if child != nil {
+			child.countAxes(usage)
+		}
+	}
+}
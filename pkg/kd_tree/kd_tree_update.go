@@ -0,0 +1,146 @@
+package kdtree
+
+import "github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+
+// Adds a point below the leaf whose cell holds it, keeping sizes, bounding boxes and aggregates
+// up to date along the way. An empty tree with no dimension takes that of the point. The tree is
+// not rebalanced, so many insertions may leave it deeper than a freshly constructed one.
+func (tree *KdTree) Insert(point common.Point) error {
+	if err := common.CheckPositiveDimension("point", point.Dimension()); err != nil {
+		return err
+	}
+	if tree.Root == nil && tree.Dimension == 0 {
+		tree.Dimension = point.Dimension()
+	}
+	if err := common.CheckDimension("point", point.Dimension(), tree.Dimension); err != nil {
+		return err
+	}
+	if err := tree.ids.Track(point, tree.Points); err != nil {
+		return err
+	}
+	tree.insert(point, 0)
+	return nil
+}
+
+func (tree *KdTree) insert(point common.Point, ordinateIndex int) {
+	if tree.Root == nil {
+		tree.Root = &KdTreeNode{Vector: point.Vector(), Data: point, OrdinateIndex: ordinateIndex, SplittingValue: point.Vector()[ordinateIndex]}
+		tree.refresh()
+		return
+	}
+	ordinateIndex = tree.Root.OrdinateIndex
+	if point.Vector()[ordinateIndex] < tree.Root.SplittingValue {
+		if tree.Left == nil {
+			tree.Left = &KdTree{Dimension: tree.Dimension, aggregate: tree.aggregate}
+		}
+		tree.Left.insert(point, (ordinateIndex+1)%tree.Dimension)
+	} else {
+		if tree.Right == nil {
+			tree.Right = &KdTree{Dimension: tree.Dimension, aggregate: tree.aggregate}
+		}
+		tree.Right.insert(point, (ordinateIndex+1)%tree.Dimension)
+	}
+	tree.refresh()
+}
+
+// Removes a point from the tree, returning whether it was found. Points are matched as by
+// common.SamePoint, so by ID or else by coordinates. A removed pivot is replaced by the nearest
+// point along its axis from below it, so that the split still separates its children.
+func (tree *KdTree) Delete(point common.Point) (bool, error) {
+	if err := common.CheckDimension("point", point.Dimension(), tree.Dimension); err != nil {
+		return false, err
+	}
+	vector := point.Vector()
+	if identified, ok := point.(common.IdentifiedPoint); ok {
+		// Descend to the stored point, as the coordinates given for it may be stale
+		stored, found := tree.ids.Lookup(identified.ID(), tree.Points)
+		if !found {
+			return false, nil
+		}
+		vector = stored.Vector()
+	}
+	removed := tree.delete(vector, func(node *KdTree) bool { return common.SamePoint(point, node.Root.Data) })
+	if removed == nil {
+		return false, nil
+	}
+	tree.ids.Untrack(removed)
+	return true, nil
+}
+
+// Removes the point of the first node matched on the way down to the vector, returning it
+func (tree *KdTree) delete(vector common.PointVector, match func(*KdTree) bool) common.Point {
+	if tree.Root == nil {
+		return nil
+	}
+	ordinateIndex := tree.Root.OrdinateIndex
+	if !match(tree) {
+		// Points on the split may lie on either side
+		value := vector[ordinateIndex]
+		var removed common.Point
+		if tree.Left != nil && value <= tree.Root.SplittingValue {
+			removed = tree.Left.delete(vector, match)
+		}
+		if removed == nil && tree.Right != nil && value >= tree.Root.SplittingValue {
+			removed = tree.Right.delete(vector, match)
+		}
+		if removed != nil {
+			tree.prune()
+			tree.refresh()
+		}
+		return removed
+	}
+	removed := tree.Root.Data
+	var holder *KdTree
+	switch {
+	case tree.Right != nil:
+		holder = tree.Right.extreme(ordinateIndex, -1)
+	case tree.Left != nil:
+		holder = tree.Left.extreme(ordinateIndex, 1)
+	default:
+		tree.Root = nil
+		return removed
+	}
+	// Take the node itself, as other points may share its coordinates
+	replacement := holder.Root.Data
+	isHolder := func(node *KdTree) bool { return node == holder }
+	if tree.Right != nil {
+		tree.Right.delete(replacement.Vector(), isHolder)
+	} else {
+		tree.Left.delete(replacement.Vector(), isHolder)
+	}
+	tree.Root = &KdTreeNode{Vector: replacement.Vector(), Data: replacement, OrdinateIndex: ordinateIndex, SplittingValue: replacement.Vector()[ordinateIndex]}
+	tree.prune()
+	tree.refresh()
+	return removed
+}
+
+// Drops children left empty by a deletion
+func (tree *KdTree) prune() {
+	if tree.Left != nil && tree.Left.Root == nil {
+		tree.Left = nil
+	}
+	if tree.Right != nil && tree.Right.Root == nil {
+		tree.Right = nil
+	}
+}
+
+// Returns the node of the subtree whose point has the largest value of sign times the given
+// ordinate
+func (tree *KdTree) extreme(ordinateIndex int, sign float64) *KdTree {
+	result := tree
+	best := sign * tree.Root.Vector[ordinateIndex]
+	for _, child := range []*KdTree{tree.Left, tree.Right} {
+		if child == nil {
+			continue
+		}
+		// A split on the same ordinate rules out one side
+		if tree.Root.OrdinateIndex == ordinateIndex && (child == tree.Left) == (sign > 0) {
+			continue
+		}
+		if candidate := child.extreme(ordinateIndex, sign); sign*candidate.Root.Vector[ordinateIndex] > best {
+			result = candidate
+			best = sign * candidate.Root.Vector[ordinateIndex]
+		}
+	}
+	return result
+}
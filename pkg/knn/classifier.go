@@ -0,0 +1,134 @@
+package knn
+
+import (
+	"fmt"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Classifier predicts the label of a point by a vote of its K nearest labelled points
+type Classifier[L comparable] struct {
+	K         int
+	Backend   Backend
+	Weighting Weighting
+	// Defaults to GOMAXPROCS
+	Workers int
+
+	index   *index
+	classes []L
+	// Indexed by fitted point
+	labels []int
+}
+
+// Fits the classifier to the points and their labels, building a tree of the chosen backend
+func (classifier *Classifier[L]) Fit(points []common.Point, labels []L) error {
+	if classifier.K <= 0 {
+		return fmt.Errorf("K must be positive, found %d", classifier.K)
+	}
+	if len(points) != len(labels) {
+		return fmt.Errorf("Found %d points but %d labels", len(points), len(labels))
+	}
+	ix, err := newIndex(points, classifier.Backend)
+	if err != nil {
+		return err
+	}
+	classifier.index = ix
+	classifier.classes = []L{}
+	classifier.labels = make([]int, len(labels))
+	classes := map[L]int{}
+	for i, label := range labels {
+		class, ok := classes[label]
+		if !ok {
+			class = len(classifier.classes)
+			classes[label] = class
+			classifier.classes = append(classifier.classes, label)
+		}
+		classifier.labels[i] = class
+	}
+	return nil
+}
+
+// The distinct labels seen by Fit, in order of first appearance. Probabilities are given in
+// this order.
+func (classifier *Classifier[L]) Classes() []L {
+	return classifier.classes
+}
+
+// Returns the most probable label of each point. Ties go to the class seen first by Fit.
+func (classifier *Classifier[L]) Predict(points []common.Point) ([]L, error) {
+	probabilities, err := classifier.PredictProbabilities(points)
+	if err != nil {
+		return nil, err
+	}
+	return classifier.choose(probabilities), nil
+}
+
+// Returns the weighted share of the vote won by each class, for each point
+func (classifier *Classifier[L]) PredictProbabilities(points []common.Point) ([][]float64, error) {
+	return classifier.probabilities(points, false)
+}
+
+// Predicts the label of every fitted point from its neighbours other than itself, returning
+// the predictions and the fraction which were correct
+func (classifier *Classifier[L]) LeaveOneOut() ([]L, float64, error) {
+	if classifier.index == nil {
+		return nil, 0, fmt.Errorf("The classifier must be fitted before use")
+	}
+	probabilities, err := classifier.probabilities(classifier.index.points, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	predictions := classifier.choose(probabilities)
+	correct := 0
+	for i, prediction := range predictions {
+		if prediction == classifier.classes[classifier.labels[i]] {
+			correct++
+		}
+	}
+	return predictions, float64(correct) / float64(len(predictions)), nil
+}
+
+func (classifier *Classifier[L]) probabilities(points []common.Point, exclude bool) ([][]float64, error) {
+	if classifier.index == nil {
+		return nil, fmt.Errorf("The classifier must be fitted before use")
+	}
+	result := make([][]float64, len(points))
+	err := parallelFor(len(points), classifier.Workers, func(i int) error {
+		self := -1
+		if exclude {
+			self = i
+		}
+		positions, weights, err := classifier.index.neighbours(points[i], classifier.K, classifier.Weighting, self)
+		if err != nil {
+			return err
+		}
+		result[i] = make([]float64, len(classifier.classes))
+		total := 0.
+		for j, position := range positions {
+			result[i][classifier.labels[position]] += weights[j]
+			total += weights[j]
+		}
+		for class := range result[i] {
+			result[i][class] /= total
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (classifier *Classifier[L]) choose(probabilities [][]float64) []L {
+	result := make([]L, len(probabilities))
+	for i, p := range probabilities {
+		best := 0
+		for class := range p {
+			if p[class] > p[best] {
+				best = class
+			}
+		}
+		result[i] = classifier.classes[best]
+	}
+	return result
+}
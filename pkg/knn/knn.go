@@ -0,0 +1,142 @@
+package knn
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	balltree "github.com/KrishanBhalla/space-partitioning-trees/pkg/ball_tree"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	kdtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/kd_tree"
+)
+
+// The tree used to find neighbours
+type Backend int
+
+const (
+	KdTreeBackend Backend = iota
+	BallTreeBackend
+)
+
+// How the neighbours of a point are weighted in a prediction
+type Weighting int
+
+const (
+	Uniform Weighting = iota
+	// Weight each neighbour by the inverse of its distance. Neighbours at distance zero, if any,
+	// take all of the weight between them.
+	DistanceWeighting
+)
+
+// The fitted points, in a tree of IndexedPoints whose IDs are their positions
+type index struct {
+	tree   common.SpacePartitioningTree
+	points []common.Point
+}
+
+func newIndex(points []common.Point, backend Backend) (*index, error) {
+	if len(points) == 0 {
+		return nil, fmt.Errorf("At least one point is required")
+	}
+	dimension := points[0].Dimension()
+	vectors := make([][]float64, len(points))
+	for i, p := range points {
+		if p.Dimension() != dimension {
+			return nil, fmt.Errorf("The point has dimension %d, but the first point has dimension %d", p.Dimension(), dimension)
+		}
+		vectors[i] = p.Vector()
+	}
+	ix := &index{points: points}
+	switch backend {
+	case KdTreeBackend:
+		ix.tree = &kdtree.KdTree{}
+	case BallTreeBackend:
+		ix.tree = &balltree.BallTree{}
+	default:
+		return nil, fmt.Errorf("Unknown backend %d", backend)
+	}
+	if err := ix.tree.Construct(common.IndexPoints(vectors), dimension); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// Returns the positions of the k fitted points nearest the query, nearest first, and their
+// weights. The fitted point at position self is excluded, for leave-one-out validation, unless
+// self is negative.
+func (ix *index) neighbours(point common.Point, k int, weighting Weighting, self int) ([]int, []float64, error) {
+	n := k
+	if self >= 0 {
+		n++
+	}
+	found, err := ix.tree.KNearestNeighbors(point, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	positions := make([]int, 0, k)
+	distances := make([]float64, 0, k)
+	zeros := 0
+	for _, p := range found {
+		position := p.(*common.IndexedPoint).Index
+		if position == self || len(positions) == k {
+			continue
+		}
+		d, err := common.Distance(point.Vector(), p.Vector())
+		if err != nil {
+			return nil, nil, err
+		}
+		positions = append(positions, position)
+		distances = append(distances, d)
+		if d == 0 {
+			zeros++
+		}
+	}
+	if len(positions) == 0 {
+		return nil, nil, fmt.Errorf("No neighbours were found")
+	}
+	weights := make([]float64, len(distances))
+	for i, d := range distances {
+		switch {
+		case weighting == Uniform:
+			weights[i] = 1
+		case zeros > 0 && d == 0:
+			weights[i] = 1
+		case zeros > 0:
+			weights[i] = 0
+		default:
+			weights[i] = 1 / d
+		}
+	}
+	return positions, weights, nil
+}
+
+// Calls fn for every index below n on a pool of workers, which defaults to GOMAXPROCS. The
+// error for the lowest index is returned.
+func parallelFor(n, workers int, fn func(i int) error) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	errs := make([]error, n)
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
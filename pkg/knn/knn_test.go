@@ -0,0 +1,254 @@
+package knn_test
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/knn"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPoint struct {
+	dimension int
+	vector    common.PointVector
+}
+
+func (t *testPoint) Dimension() int {
+	return t.dimension
+}
+
+func (t *testPoint) Vector() common.PointVector {
+	return t.vector
+}
+
+func createPoint(dimension int, lowerBound, upperBound float64) common.Point {
+	vector := make([]float64, dimension)
+	for i := range vector {
+		vector[i] = lowerBound + rand.Float64()*(upperBound-lowerBound)
+	}
+	return &testPoint{dimension: dimension, vector: vector}
+}
+
+func createPoints(nPoints, dimension int, lowerBound, upperBound float64) []common.Point {
+	result := make([]common.Point, nPoints)
+	for i := range result {
+		result[i] = createPoint(dimension, lowerBound, upperBound)
+	}
+	return result
+}
+
+var backends = map[string]knn.Backend{"kd": knn.KdTreeBackend, "ball": knn.BallTreeBackend}
+
+// The k points nearest the query by brute force, optionally excluding the query itself, with
+// their distances
+func bruteForceNeighbours(query common.Point, points []common.Point, k int, exclude bool) ([]int, []float64) {
+	indices := []int{}
+	for i, p := range points {
+		if !exclude || p != query {
+			indices = append(indices, i)
+		}
+	}
+	distance := func(i int) float64 {
+		d, _ := common.Distance(query.Vector(), points[i].Vector())
+		return d
+	}
+	sort.Slice(indices, func(a, b int) bool { return distance(indices[a]) < distance(indices[b]) })
+	indices = indices[:k]
+	distances := make([]float64, k)
+	for i, index := range indices {
+		distances[i] = distance(index)
+	}
+	return indices, distances
+}
+
+// Labels points by quadrant, with some noise
+func quadrantLabel(p common.Point) string {
+	v := p.Vector()
+	if rand.Float64() < 0.05 {
+		return "noise"
+	}
+	if v[0] < 0 == (v[1] < 0) {
+		return "even"
+	}
+	return "odd"
+}
+
+func TestClassifierMatchesBruteForce(t *testing.T) {
+	points := createPoints(500, 2, -1, 1)
+	labels := common.Map(points, quadrantLabel)
+	queries := createPoints(50, 2, -1, 1)
+	k := 7
+	for name, backend := range backends {
+		for _, weighting := range []knn.Weighting{knn.Uniform, knn.DistanceWeighting} {
+			classifier := knn.Classifier[string]{K: k, Backend: backend, Weighting: weighting}
+			assert.Nil(t, classifier.Fit(points, labels))
+			assert.Equal(t, []string{labels[0]}, classifier.Classes()[:1])
+			probabilities, err := classifier.PredictProbabilities(queries)
+			assert.Nil(t, err)
+			predictions, err := classifier.Predict(queries)
+			assert.Nil(t, err)
+			for i, q := range queries {
+				indices, distances := bruteForceNeighbours(q, points, k, false)
+				expected := map[string]float64{}
+				total := 0.
+				for j, index := range indices {
+					w := 1.
+					if weighting == knn.DistanceWeighting {
+						w = 1 / distances[j]
+					}
+					expected[labels[index]] += w
+					total += w
+				}
+				best := ""
+				for c, class := range classifier.Classes() {
+					assert.InDelta(t, expected[class]/total, probabilities[i][c], 1e-9, name)
+					if best == "" || expected[class] > expected[best] {
+						best = class
+					}
+				}
+				assert.Equal(t, best, predictions[i], name)
+			}
+		}
+	}
+}
+
+func TestClassifierLeaveOneOut(t *testing.T) {
+	points := createPoints(400, 2, -1, 1)
+	labels := common.Map(points, quadrantLabel)
+	k := 5
+	for name, backend := range backends {
+		classifier := knn.Classifier[string]{K: k, Backend: backend}
+		assert.Nil(t, classifier.Fit(points, labels))
+		predictions, accuracy, err := classifier.LeaveOneOut()
+		assert.Nil(t, err)
+		correct := 0
+		for i, p := range points {
+			// Each point is voted on by its neighbours, never by itself
+			indices, _ := bruteForceNeighbours(p, points, k, true)
+			votes := map[string]int{}
+			for _, index := range indices {
+				votes[labels[index]]++
+			}
+			assert.Equal(t, k, votes["even"]+votes["odd"]+votes["noise"])
+			assert.GreaterOrEqual(t, votes[predictions[i]], (k+2)/3, name)
+			if predictions[i] == labels[i] {
+				correct++
+			}
+		}
+		assert.Equal(t, float64(correct)/float64(len(points)), accuracy, name)
+		assert.Greater(t, accuracy, 0.8, name)
+	}
+}
+
+func TestDistanceWeightingFavoursExactMatches(t *testing.T) {
+	points := []common.Point{
+		&testPoint{dimension: 1, vector: common.PointVector{0}},
+		&testPoint{dimension: 1, vector: common.PointVector{1}},
+		&testPoint{dimension: 1, vector: common.PointVector{1.1}},
+	}
+	classifier := knn.Classifier[int]{K: 3, Weighting: knn.DistanceWeighting}
+	assert.Nil(t, classifier.Fit(points, []int{1, 2, 2}))
+	probabilities, err := classifier.PredictProbabilities([]common.Point{&testPoint{dimension: 1, vector: common.PointVector{0}}})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]float64{{1, 0}}, probabilities)
+}
+
+func TestRegressor(t *testing.T) {
+	points := createPoints(500, 3, 0, 1)
+	targets := common.Map(points, func(p common.Point) float64 {
+		v := p.Vector()
+		return math.Sin(3*v[0]) + v[1]*v[2]
+	})
+	queries := createPoints(50, 3, 0, 1)
+	k := 6
+	for name, backend := range backends {
+		for _, weighting := range []knn.Weighting{knn.Uniform, knn.DistanceWeighting} {
+			regressor := knn.Regressor{K: k, Backend: backend, Weighting: weighting, Workers: 2}
+			assert.Nil(t, regressor.Fit(points, targets))
+			predictions, err := regressor.Predict(queries)
+			assert.Nil(t, err)
+			for i, q := range queries {
+				indices, distances := bruteForceNeighbours(q, points, k, false)
+				expected, total := 0., 0.
+				for j, index := range indices {
+					w := 1.
+					if weighting == knn.DistanceWeighting {
+						w = 1 / distances[j]
+					}
+					expected += w * targets[index]
+					total += w
+				}
+				assert.InDelta(t, expected/total, predictions[i], 1e-9, name)
+			}
+
+			looPredictions, meanSquaredError, err := regressor.LeaveOneOut()
+			assert.Nil(t, err)
+			squaredError := 0.
+			for i, p := range points {
+				indices, _ := bruteForceNeighbours(p, points, k, true)
+				if weighting == knn.Uniform {
+					expected := 0.
+					for _, index := range indices {
+						expected += targets[index] / float64(k)
+					}
+					assert.InDelta(t, expected, looPredictions[i], 1e-9, name)
+				}
+				squaredError += (looPredictions[i] - targets[i]) * (looPredictions[i] - targets[i])
+			}
+			assert.InDelta(t, squaredError/float64(len(points)), meanSquaredError, 1e-12, name)
+			assert.Less(t, meanSquaredError, 0.05, name)
+		}
+	}
+}
+
+func TestKnnErrors(t *testing.T) {
+	points := createPoints(10, 2, 0, 1)
+	labels := make([]int, 10)
+	assert.NotNil(t, (&knn.Classifier[int]{K: 0}).Fit(points, labels))
+	assert.NotNil(t, (&knn.Classifier[int]{K: 1}).Fit(points, labels[:5]))
+	assert.NotNil(t, (&knn.Classifier[int]{K: 1, Backend: knn.Backend(7)}).Fit(points, labels))
+	assert.NotNil(t, (&knn.Classifier[int]{K: 1}).Fit(append(points, createPoint(3, 0, 1)), append(labels, 0)))
+	assert.NotNil(t, (&knn.Regressor{K: 1}).Fit([]common.Point{}, []float64{}))
+
+	classifier := knn.Classifier[int]{K: 1}
+	_, err := classifier.Predict(points)
+	assert.NotNil(t, err)
+	_, _, err = classifier.LeaveOneOut()
+	assert.NotNil(t, err)
+	assert.Nil(t, classifier.Fit(points, labels))
+	_, err = classifier.Predict([]common.Point{createPoint(3, 0, 1)})
+	assert.NotNil(t, err)
+
+	regressor := knn.Regressor{K: 1}
+	assert.Nil(t, regressor.Fit(points[:1], []float64{1}))
+	_, _, err = regressor.LeaveOneOut()
+	assert.NotNil(t, err, "Expecting a lone point to have no neighbours to learn from")
+}
+
+// A point held by value, which cannot be compared as it holds a slice
+type valuePoint struct {
+	vector common.PointVector
+}
+
+func (v valuePoint) Dimension() int {
+	return len(v.vector)
+}
+
+func (v valuePoint) Vector() common.PointVector {
+	return v.vector
+}
+
+func TestKnnAcceptsUncomparablePoints(t *testing.T) {
+	points := []common.Point{valuePoint{common.PointVector{0, 0}}, valuePoint{common.PointVector{0, 0}}, valuePoint{common.PointVector{5, 5}}}
+	for name, backend := range backends {
+		classifier := knn.Classifier[string]{K: 1, Backend: backend}
+		assert.Nil(t, classifier.Fit(points, []string{"a", "b", "c"}), name)
+		predictions, _, err := classifier.LeaveOneOut()
+		assert.Nil(t, err, name)
+		// Duplicates are distinct points, each the other's nearest neighbour
+		assert.Equal(t, []string{"b", "a"}, predictions[:2], name)
+	}
+}
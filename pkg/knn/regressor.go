@@ -0,0 +1,86 @@
+package knn
+
+import (
+	"fmt"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+// Regressor predicts the value at a point as the weighted mean over its K nearest fitted points
+type Regressor struct {
+	K         int
+	Backend   Backend
+	Weighting Weighting
+	// Defaults to GOMAXPROCS
+	Workers int
+
+	index *index
+	// Indexed by fitted point
+	targets []float64
+}
+
+// Fits the regressor to the points and their values, building a tree of the chosen backend
+func (regressor *Regressor) Fit(points []common.Point, targets []float64) error {
+	if regressor.K <= 0 {
+		return fmt.Errorf("K must be positive, found %d", regressor.K)
+	}
+	if len(points) != len(targets) {
+		return fmt.Errorf("Found %d points but %d targets", len(points), len(targets))
+	}
+	ix, err := newIndex(points, regressor.Backend)
+	if err != nil {
+		return err
+	}
+	regressor.index = ix
+	regressor.targets = append([]float64{}, targets...)
+	return nil
+}
+
+func (regressor *Regressor) Predict(points []common.Point) ([]float64, error) {
+	return regressor.predict(points, false)
+}
+
+// Predicts the value at every fitted point from its neighbours other than itself, returning
+// the predictions and their mean squared error
+func (regressor *Regressor) LeaveOneOut() ([]float64, float64, error) {
+	if regressor.index == nil {
+		return nil, 0, fmt.Errorf("The regressor must be fitted before use")
+	}
+	predictions, err := regressor.predict(regressor.index.points, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	squaredError := 0.
+	for i, prediction := range predictions {
+		squaredError += (prediction - regressor.targets[i]) * (prediction - regressor.targets[i])
+	}
+	return predictions, squaredError / float64(len(predictions)), nil
+}
+
+func (regressor *Regressor) predict(points []common.Point, exclude bool) ([]float64, error) {
+	if regressor.index == nil {
+		return nil, fmt.Errorf("The regressor must be fitted before use")
+	}
+	result := make([]float64, len(points))
+	err := parallelFor(len(points), regressor.Workers, func(i int) error {
+		self := -1
+		if exclude {
+			self = i
+		}
+		positions, weights, err := regressor.index.neighbours(points[i], regressor.K, regressor.Weighting, self)
+		if err != nil {
+			return err
+		}
+		total := 0.
+		for j, position := range positions {
+			result[i] += weights[j] * regressor.targets[position]
+			total += weights[j]
+		}
+		result[i] /= total
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
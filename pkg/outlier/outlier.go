@@ -0,0 +1,193 @@
+package outlier
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+)
+
+type Method int
+
+const (
+	// The Local Outlier Factor of Breunig et al., comparing the density about a point with the
+	// density about its neighbours. Scores near one are typical, and larger scores are outliers.
+	LocalOutlierFactor Method = iota
+	// The distance to the k-th nearest neighbour
+	KNearestDistance
+	// The mean distance to the k nearest neighbours
+	AverageKNearestDistance
+)
+
+// Added to mean reachability distances, as scikit-learn does, so that duplicated points have
+// a large but finite local density rather than dividing by zero
+const reachabilityEpsilon = 1e-10
+
+// Detector scores points by how isolated they are from their k nearest neighbours in a tree,
+// larger scores being more anomalous. Any SpacePartitioningTree will do, as its k-nearest
+// neighbour queries are exact.
+type Detector struct {
+	K      int
+	Method Method
+	// Defaults to GOMAXPROCS
+	Workers int
+
+	tree  common.SpacePartitioningTree
+	index common.CoordinateIndex
+	// Indexed by fitted point, coincident points sharing the values of the first
+	kDistance    []float64
+	localDensity []float64
+}
+
+// The k nearest neighbours of a point, by fitted index
+type neighbourhood struct {
+	indices   []int
+	distances []float64
+}
+
+// Fits the detector to the points, which must be exactly the points the tree was constructed
+// from, and returns their scores. Points are matched to the tree by their coordinates, and a
+// point is never its own neighbour, though any duplicates of it are.
+func (detector *Detector) Fit(tree common.SpacePartitioningTree, points []common.Point) ([]float64, error) {
+	if detector.Method < LocalOutlierFactor || detector.Method > AverageKNearestDistance {
+		return nil, fmt.Errorf("Unknown method %d", detector.Method)
+	}
+	if detector.K <= 0 || detector.K >= len(points) {
+		return nil, fmt.Errorf("K must be positive and less than the number of points %d, found %d", len(points), detector.K)
+	}
+	if tree.Size() != len(points) {
+		return nil, fmt.Errorf("The tree holds %d points, but %d points were given", tree.Size(), len(points))
+	}
+	detector.tree = tree
+	detector.index = common.NewCoordinateIndex(points)
+	neighbourhoods, err := detector.neighbourhoods(points, true)
+	if err != nil {
+		detector.tree = nil
+		return nil, err
+	}
+	detector.kDistance = make([]float64, len(points))
+	for i, n := range neighbourhoods {
+		detector.kDistance[i] = n.distances[detector.K-1]
+	}
+	detector.localDensity = make([]float64, len(points))
+	for i, n := range neighbourhoods {
+		detector.localDensity[i] = detector.reachabilityDensity(n)
+	}
+	return detector.scores(neighbourhoods), nil
+}
+
+// Scores new points against the fitted points by their coordinates alone, so that a point
+// coinciding with a fitted point counts it as a neighbour
+func (detector *Detector) Score(points []common.Point) ([]float64, error) {
+	if detector.tree == nil {
+		return nil, fmt.Errorf("The detector must be fitted before use")
+	}
+	neighbourhoods, err := detector.neighbourhoods(points, false)
+	if err != nil {
+		return nil, err
+	}
+	return detector.scores(neighbourhoods), nil
+}
+
+// Finds the k nearest fitted neighbours of each point in parallel, leaving the points themselves
+// out when they are those fitted
+func (detector *Detector) neighbourhoods(points []common.Point, fitted bool) ([]neighbourhood, error) {
+	workers := detector.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	result := make([]neighbourhood, len(points))
+	errs := make([]error, len(points))
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				result[i], errs[i] = detector.neighbourhood(points[i], fitted)
+			}
+		}()
+	}
+	for i := range points {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (detector *Detector) neighbourhood(point common.Point, fitted bool) (neighbourhood, error) {
+	k := detector.K
+	if fitted {
+		// Ask for one more to leave the point out. Duplicates tie with it, so any neighbour at
+		// distance zero will do.
+		k++
+	}
+	neighbours, err := detector.tree.KNearestNeighbors(point, k)
+	if err != nil {
+		return neighbourhood{}, err
+	}
+	self := !fitted
+	result := neighbourhood{indices: make([]int, 0, detector.K), distances: make([]float64, 0, detector.K)}
+	for _, n := range neighbours {
+		group := detector.index.Of(n)
+		if len(group) == 0 {
+			return neighbourhood{}, fmt.Errorf("The tree holds points which were not fitted")
+		}
+		d, err := common.Distance(point.Vector(), n.Vector())
+		if err != nil {
+			return neighbourhood{}, err
+		}
+		if !self && d == 0 {
+			self = true
+			continue
+		}
+		if len(result.indices) < detector.K {
+			result.indices = append(result.indices, group[0])
+			result.distances = append(result.distances, d)
+		}
+	}
+	if !self {
+		return neighbourhood{}, fmt.Errorf("The point %v is not in the tree", point.Vector())
+	}
+	if len(result.indices) < detector.K {
+		return neighbourhood{}, fmt.Errorf("Found %d neighbours, but K is %d", len(result.indices), detector.K)
+	}
+	return result, nil
+}
+
+// The inverse of the mean reachability distance max(k-distance(o), d(p, o)) to the neighbours
+func (detector *Detector) reachabilityDensity(n neighbourhood) float64 {
+	reachability := 0.
+	for j, index := range n.indices {
+		reachability += math.Max(detector.kDistance[index], n.distances[j])
+	}
+	return 1 / (reachability/float64(len(n.indices)) + reachabilityEpsilon)
+}
+
+func (detector *Detector) scores(neighbourhoods []neighbourhood) []float64 {
+	result := make([]float64, len(neighbourhoods))
+	for i, n := range neighbourhoods {
+		switch detector.Method {
+		case LocalOutlierFactor:
+			density := 0.
+			for _, index := range n.indices {
+				density += detector.localDensity[index]
+			}
+			result[i] = density / float64(len(n.indices)) / detector.reachabilityDensity(n)
+		case KNearestDistance:
+			result[i] = n.distances[len(n.distances)-1]
+		case AverageKNearestDistance:
+			result[i] = common.Reduce(n.distances, 0., func(sum, d float64) float64 { return sum + d }) / float64(len(n.distances))
+		}
+	}
+	return result
+}
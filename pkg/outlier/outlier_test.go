@@ -0,0 +1,209 @@
+package outlier_test
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	balltree "github.com/KrishanBhalla/space-partitioning-trees/pkg/ball_tree"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/common"
+	kdtree "github.com/KrishanBhalla/space-partitioning-trees/pkg/kd_tree"
+	"github.com/KrishanBhalla/space-partitioning-trees/pkg/outlier"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPoint struct {
+	dimension int
+	vector    common.PointVector
+}
+
+func (t *testPoint) Dimension() int {
+	return t.dimension
+}
+
+func (t *testPoint) Vector() common.PointVector {
+	return t.vector
+}
+
+func createPoint(dimension int, lowerBound, upperBound float64) common.Point {
+	vector := make([]float64, dimension)
+	for i := range vector {
+		vector[i] = lowerBound + rand.Float64()*(upperBound-lowerBound)
+	}
+	return &testPoint{dimension: dimension, vector: vector}
+}
+
+func createPoints(nPoints, dimension int, lowerBound, upperBound float64) []common.Point {
+	result := make([]common.Point, nPoints)
+	for i := range result {
+		result[i] = createPoint(dimension, lowerBound, upperBound)
+	}
+	return result
+}
+
+func createTrees(points []common.Point, dimension int) map[string]common.SpacePartitioningTree {
+	kd := kdtree.KdTree{}
+	kd.Construct(points, dimension)
+	ball := balltree.BallTree{}
+	ball.Construct(points, dimension)
+	return map[string]common.SpacePartitioningTree{"kd": &kd, "ball": &ball}
+}
+
+// Scores each query against the points by brute force. The points themselves are scored when
+// queries is nil, each leaving itself out.
+func bruteForceScores(method outlier.Method, k int, points, queries []common.Point) []float64 {
+	type neighbour struct {
+		index    int
+		distance float64
+	}
+	nearest := func(q common.Point, self int) []neighbour {
+		result := []neighbour{}
+		for i, p := range points {
+			if i != self {
+				d, _ := common.Distance(q.Vector(), p.Vector())
+				result = append(result, neighbour{i, d})
+			}
+		}
+		sort.Slice(result, func(i, j int) bool { return result[i].distance < result[j].distance })
+		return result[:k]
+	}
+	kDistance := make([]float64, len(points))
+	for i, p := range points {
+		kDistance[i] = nearest(p, i)[k-1].distance
+	}
+	density := func(neighbours []neighbour) float64 {
+		reachability := 0.
+		for _, n := range neighbours {
+			reachability += math.Max(kDistance[n.index], n.distance)
+		}
+		return 1 / (reachability/float64(k) + 1e-10)
+	}
+	fitted := queries == nil
+	if fitted {
+		queries = points
+	}
+	result := make([]float64, len(queries))
+	for i, q := range queries {
+		self := -1
+		if fitted {
+			self = i
+		}
+		neighbours := nearest(q, self)
+		switch method {
+		case outlier.LocalOutlierFactor:
+			for _, n := range neighbours {
+				result[i] += density(nearest(points[n.index], n.index)) / float64(k)
+			}
+			result[i] /= density(neighbours)
+		case outlier.KNearestDistance:
+			result[i] = neighbours[k-1].distance
+		case outlier.AverageKNearestDistance:
+			for _, n := range neighbours {
+				result[i] += n.distance / float64(k)
+			}
+		}
+	}
+	return result
+}
+
+func TestScoresMatchBruteForce(t *testing.T) {
+	dimension := 2
+	k := 5
+	points := createPoints(300, dimension, 0, 10)
+	queries := createPoints(20, dimension, -5, 15)
+	for name, tree := range createTrees(points, dimension) {
+		for _, method := range []outlier.Method{outlier.LocalOutlierFactor, outlier.KNearestDistance, outlier.AverageKNearestDistance} {
+			detector := outlier.Detector{K: k, Method: method, Workers: 3}
+			scores, err := detector.Fit(tree, points)
+			assert.Nil(t, err)
+			assert.InDeltaSlice(t, bruteForceScores(method, k, points, nil), scores, 1e-9, name)
+
+			queryScores, err := detector.Score(queries)
+			assert.Nil(t, err)
+			assert.InDeltaSlice(t, bruteForceScores(method, k, points, queries), queryScores, 1e-9, name)
+
+			// A fitted point scored again is its own neighbour
+			again, err := detector.Score(points[:10])
+			assert.Nil(t, err)
+			assert.InDeltaSlice(t, bruteForceScores(method, k, points, points[:10]), again, 1e-9, name)
+		}
+	}
+}
+
+func TestScoreIgnoresIDs(t *testing.T) {
+	dimension := 2
+	k := 5
+	points := common.IndexPoints(common.Map(createPoints(200, dimension, 0, 10), func(p common.Point) []float64 { return p.Vector() }))
+	// The queries share the IDs of fitted points, but lie elsewhere
+	queries := common.IndexPoints(common.Map(createPoints(20, dimension, -5, 15), func(p common.Point) []float64 { return p.Vector() }))
+	for name, tree := range createTrees(points, dimension) {
+		detector := outlier.Detector{K: k}
+		scores, err := detector.Fit(tree, points)
+		assert.Nil(t, err)
+		queryScores, err := detector.Score(queries)
+		assert.Nil(t, err)
+		assert.InDeltaSlice(t, bruteForceScores(outlier.LocalOutlierFactor, k, points, queries), queryScores, 1e-9, name)
+		assert.NotEqual(t, scores[:len(queries)], queryScores, name)
+	}
+}
+
+func TestLocalOutlierFactorFindsOutliers(t *testing.T) {
+	dimension := 2
+	points := createPoints(500, dimension, 0, 1)
+	isolated := &testPoint{dimension: dimension, vector: common.PointVector{5, 5}}
+	points = append(points, isolated)
+	for name, tree := range createTrees(points, dimension) {
+		detector := outlier.Detector{K: 10}
+		scores, err := detector.Fit(tree, points)
+		assert.Nil(t, err)
+		for _, score := range scores[:500] {
+			assert.Less(t, score, scores[500], name)
+		}
+		assert.Greater(t, scores[500], 5., name)
+	}
+}
+
+func TestDuplicatePointsHaveFiniteScores(t *testing.T) {
+	dimension := 2
+	points := createPoints(50, dimension, 0, 1)
+	for i := 0; i < 20; i++ {
+		points = append(points, &testPoint{dimension: dimension, vector: common.PointVector{0.5, 0.5}})
+	}
+	for name, tree := range createTrees(points, dimension) {
+		for _, method := range []outlier.Method{outlier.LocalOutlierFactor, outlier.KNearestDistance, outlier.AverageKNearestDistance} {
+			detector := outlier.Detector{K: 5, Method: method}
+			scores, err := detector.Fit(tree, points)
+			assert.Nil(t, err)
+			for _, score := range scores {
+				assert.False(t, math.IsNaN(score) || math.IsInf(score, 0), name)
+			}
+			scores, err = detector.Score([]common.Point{&testPoint{dimension: dimension, vector: common.PointVector{0.5, 0.5}}})
+			assert.Nil(t, err)
+			assert.False(t, math.IsNaN(scores[0]) || math.IsInf(scores[0], 0), name)
+		}
+	}
+}
+
+func TestDetectorErrors(t *testing.T) {
+	points := createPoints(10, 2, 0, 1)
+	tree := createTrees(points, 2)["kd"]
+	_, err := (&outlier.Detector{K: 0}).Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = (&outlier.Detector{K: 10}).Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = (&outlier.Detector{K: 2, Method: outlier.Method(5)}).Fit(tree, points)
+	assert.NotNil(t, err)
+	_, err = (&outlier.Detector{K: 2}).Fit(tree, points[:5])
+	assert.NotNil(t, err)
+
+	detector := outlier.Detector{K: 2}
+	_, err = detector.Score(points)
+	assert.NotNil(t, err)
+	_, err = detector.Fit(tree, points)
+	assert.Nil(t, err)
+	_, err = detector.Score([]common.Point{createPoint(3, 0, 1)})
+	assert.NotNil(t, err)
+	_, err = (&outlier.Detector{K: 2}).Fit(tree, createPoints(10, 2, 0, 1))
+	assert.NotNil(t, err, "Expecting points not in the tree to be rejected")
+}